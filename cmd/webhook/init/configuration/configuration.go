@@ -1,26 +1,67 @@
 package configuration
 
 import (
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/caarlos0/env/v11"
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
 
 	"go.uber.org/zap"
 )
 
 // Config struct for configuration environmental variables
 type Config struct {
-	ServerHost           string        `env:"SERVER_HOST" envDefault:"localhost"`
-	ServerPort           int           `env:"SERVER_PORT" envDefault:"8888"`
-	ServerReadTimeout    time.Duration `env:"SERVER_READ_TIMEOUT"`
-	ServerWriteTimeout   time.Duration `env:"SERVER_WRITE_TIMEOUT"`
-	DomainFilter         []string      `env:"DOMAIN_FILTER" envDefault:""`
-	ExcludeDomains       []string      `env:"EXCLUDE_DOMAIN_FILTER" envDefault:""`
-	RegexDomainFilter    string        `env:"REGEXP_DOMAIN_FILTER" envDefault:""`
-	RegexDomainExclusion string        `env:"REGEXP_DOMAIN_FILTER_EXCLUSION" envDefault:""`
+	ProviderMode                 string        `env:"PROVIDER_MODE" envDefault:"unifi"`
+	ServerHost                   string        `env:"SERVER_HOST" envDefault:"localhost"`
+	ServerPort                   int           `env:"SERVER_PORT" envDefault:"8888"`
+	ServerReadTimeout            time.Duration `env:"SERVER_READ_TIMEOUT"`
+	ServerWriteTimeout           time.Duration `env:"SERVER_WRITE_TIMEOUT"`
+	ServerRecordsTimeout         time.Duration `env:"SERVER_RECORDS_TIMEOUT" envDefault:"30s"`
+	ServerApplyChangesTimeout    time.Duration `env:"SERVER_APPLY_CHANGES_TIMEOUT" envDefault:"2m"`
+	ServerAdjustEndpointsTimeout time.Duration `env:"SERVER_ADJUST_ENDPOINTS_TIMEOUT" envDefault:"30s"`
+	ServerMaxRequestBodySize     int64         `env:"SERVER_MAX_REQUEST_BODY_SIZE" envDefault:"10485760"`
+	ServerShutdownTimeout        time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	ServerTLSCertFile            string        `env:"SERVER_TLS_CERT_FILE"`
+	ServerTLSKeyFile             string        `env:"SERVER_TLS_KEY_FILE"`
+	ServerTLSReloadInterval      time.Duration `env:"SERVER_TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	ServerTLSSelfSigned          bool          `env:"SERVER_TLS_SELF_SIGNED" envDefault:"false"`
+	ServerTLSSelfSignedSANs      []string      `env:"SERVER_TLS_SELF_SIGNED_SANS" envDefault:"localhost,127.0.0.1,::1"`
+	ServerDebugToken             string        `env:"SERVER_DEBUG_TOKEN"`
+	ServerAdminToken             string        `env:"SERVER_ADMIN_TOKEN"`
+	Tenants                      []string      `env:"TENANTS"`
+	MetricsUnifiAPIBuckets       []float64     `env:"METRICS_UNIFI_API_DURATION_BUCKETS"`
+	MetricsHTTPRequestBuckets    []float64     `env:"METRICS_HTTP_REQUEST_DURATION_BUCKETS"`
+	KubernetesEvents             bool          `env:"KUBERNETES_EVENTS" envDefault:"false"`
+	LeaderElection               bool          `env:"LEADER_ELECTION" envDefault:"false"`
+	LeaderElectionLeaseName      string        `env:"LEADER_ELECTION_LEASE_NAME" envDefault:"external-dns-unifi-webhook"`
+	LeaderElectionNamespace      string        `env:"LEADER_ELECTION_NAMESPACE"`
+	LeaderElectionLeaseDuration  time.Duration `env:"LEADER_ELECTION_LEASE_DURATION" envDefault:"15s"`
+	LeaderElectionRenewDeadline  time.Duration `env:"LEADER_ELECTION_RENEW_DEADLINE" envDefault:"10s"`
+	LeaderElectionRetryPeriod    time.Duration `env:"LEADER_ELECTION_RETRY_PERIOD" envDefault:"2s"`
+	DomainFilter                 []string      `env:"DOMAIN_FILTER" envDefault:""`
+	ExcludeDomains               []string      `env:"EXCLUDE_DOMAIN_FILTER" envDefault:""`
+	RegexDomainFilter            string        `env:"REGEXP_DOMAIN_FILTER" envDefault:""`
+	RegexDomainExclusion         string        `env:"REGEXP_DOMAIN_FILTER_EXCLUSION" envDefault:""`
+	TargetNetFilter              []string      `env:"TARGET_NET_FILTER" envDefault:""`
+	ExcludeTargetNets            []string      `env:"EXCLUDE_TARGET_NETS" envDefault:""`
 }
 
+// Provider modes.
+const (
+	// ProviderModeUnifi manages the records of a UniFi controller.
+	ProviderModeUnifi = "unifi"
+	// ProviderModeFake manages records kept in an in-memory store instead of a controller.
+	ProviderModeFake = "fake"
+)
+
+var (
+	tenantName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	// reservedTenants are the paths served by the health server.
+	reservedTenants = map[string]bool{"metrics": true, "healthz": true, "readyz": true, "version": true, "status": true, "config": true, "last-apply": true, "debug": true, "admin": true}
+)
+
 // Init sets up configuration by reading set environmental variables
 func Init() Config {
 	cfg := Config{}
@@ -29,3 +70,34 @@ func Init() Config {
 	}
 	return cfg
 }
+
+// Validate checks the configuration for values that cannot work
+func (c Config) Validate() error {
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		return fmt.Errorf("invalid server port: %d", c.ServerPort)
+	}
+	if c.ProviderMode != ProviderModeUnifi && c.ProviderMode != ProviderModeFake {
+		return fmt.Errorf("invalid provider mode %q: use %s or %s", c.ProviderMode, ProviderModeUnifi, ProviderModeFake)
+	}
+	if (c.ServerTLSCertFile == "") != (c.ServerTLSKeyFile == "") {
+		return fmt.Errorf("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together")
+	}
+	if c.ServerTLSSelfSigned && c.ServerTLSCertFile != "" {
+		return fmt.Errorf("SERVER_TLS_SELF_SIGNED cannot be combined with SERVER_TLS_CERT_FILE")
+	}
+	for _, tenant := range c.Tenants {
+		if !tenantName.MatchString(tenant) {
+			return fmt.Errorf("invalid tenant name %q: use lowercase letters, digits and hyphens", tenant)
+		}
+		if reservedTenants[tenant] {
+			return fmt.Errorf("invalid tenant name %q: reserved by the health server", tenant)
+		}
+	}
+	if _, err := regexp.Compile(c.RegexDomainFilter); err != nil {
+		return fmt.Errorf("invalid regexp domain filter: %w", err)
+	}
+	if _, err := regexp.Compile(c.RegexDomainExclusion); err != nil {
+		return fmt.Errorf("invalid regexp domain filter exclusion: %w", err)
+	}
+	return nil
+}
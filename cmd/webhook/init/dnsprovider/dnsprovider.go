@@ -2,32 +2,53 @@ package dnsprovider
 
 import (
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/configuration"
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
 	"github.com/kashalls/external-dns-unifi-webhook/internal/unifi"
+	"go.uber.org/zap"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/provider"
 )
 
 type UnifiProviderFactory func(baseProvider *provider.BaseProvider, unifiConfig *unifi.Config) provider.Provider
 
-func Init(config configuration.Config) (provider.Provider, error) {
+// Init creates the providers keyed by tenant name. Without tenants, a single provider
+// is returned under the empty name. Each tenant reads its UniFi configuration from the
+// environment variables prefixed with its name, e.g. SITE_A_UNIFI_HOST for the tenant site-a.
+func Init(config configuration.Config) (map[string]provider.Provider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	var domainFilter endpoint.DomainFilter
 	createMsg := "creating unifi provider with "
 
-	if config.RegexDomainFilter != "" {
-		createMsg += fmt.Sprintf("regexp domain filter: '%s', ", config.RegexDomainFilter)
+	// An exclusion without an inclusion regex matches every domain not excluded.
+	if config.RegexDomainFilter != "" || config.RegexDomainExclusion != "" {
+		if len(config.DomainFilter) > 0 || len(config.ExcludeDomains) > 0 {
+			log.Warn("DOMAIN_FILTER and EXCLUDE_DOMAIN_FILTER are ignored when a regexp domain filter is configured")
+		}
+		include, err := regexp.Compile(config.RegexDomainFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REGEXP_DOMAIN_FILTER %q: %w", config.RegexDomainFilter, err)
+		}
+		exclude, err := regexp.Compile(config.RegexDomainExclusion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REGEXP_DOMAIN_FILTER_EXCLUSION %q: %w", config.RegexDomainExclusion, err)
+		}
+
+		if config.RegexDomainFilter != "" {
+			createMsg += fmt.Sprintf("regexp domain filter: '%s', ", config.RegexDomainFilter)
+		}
 		if config.RegexDomainExclusion != "" {
 			createMsg += fmt.Sprintf("with exclusion: '%s', ", config.RegexDomainExclusion)
 		}
-		domainFilter = endpoint.NewRegexDomainFilter(
-			regexp.MustCompile(config.RegexDomainFilter),
-			regexp.MustCompile(config.RegexDomainExclusion),
-		)
+		domainFilter = endpoint.NewRegexDomainFilter(include, exclude)
 	} else {
 		if config.DomainFilter != nil && len(config.DomainFilter) > 0 {
 			createMsg += fmt.Sprintf("domain filter: '%s', ", strings.Join(config.DomainFilter, ","))
@@ -38,16 +59,63 @@ func Init(config configuration.Config) (provider.Provider, error) {
 		domainFilter = endpoint.NewDomainFilterWithExclusions(config.DomainFilter, config.ExcludeDomains)
 	}
 
+	for _, cidr := range append(config.TargetNetFilter, config.ExcludeTargetNets...) {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); cidr != "" && err != nil {
+			return nil, fmt.Errorf("invalid target net filter %q: %v", cidr, err)
+		}
+	}
+	if len(config.TargetNetFilter) > 0 {
+		createMsg += fmt.Sprintf("target net filter: '%s', ", strings.Join(config.TargetNetFilter, ","))
+	}
+	if len(config.ExcludeTargetNets) > 0 {
+		createMsg += fmt.Sprintf("exclude target nets: '%s', ", strings.Join(config.ExcludeTargetNets, ","))
+	}
+	targetFilter := endpoint.NewTargetNetFilterWithExclusions(config.TargetNetFilter, config.ExcludeTargetNets)
+
 	createMsg = strings.TrimSuffix(createMsg, ", ")
 	if strings.HasSuffix(createMsg, "with ") {
 		createMsg += "no kind of domain filters"
 	}
 	log.Info(createMsg)
 
+	if len(config.Tenants) == 0 {
+		p, err := newProvider(config.ProviderMode, domainFilter, targetFilter, "", "")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]provider.Provider{"": p}, nil
+	}
+
+	// Each tenant serves a single site and answers Records for it alone, no records of several
+	// sites are fetched or merged by one request.
+	providers := map[string]provider.Provider{}
+	for _, tenant := range config.Tenants {
+		log.Info("creating unifi provider for tenant", zap.String("tenant", tenant), zap.String("env_prefix", TenantPrefix(tenant)))
+		p, err := newProvider(config.ProviderMode, domainFilter, targetFilter, tenant, TenantPrefix(tenant))
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+		providers[tenant] = p
+	}
+	return providers, nil
+}
+
+// TenantPrefix returns the prefix of the environment variables configuring a tenant.
+func TenantPrefix(tenant string) string {
+	return strings.ToUpper(strings.ReplaceAll(tenant, "-", "_")) + "_"
+}
+
+func newProvider(mode string, domainFilter endpoint.DomainFilter, targetFilter endpoint.TargetNetFilter, tenant, prefix string) (provider.Provider, error) {
 	unifiConfig := unifi.Config{}
-	if err := env.Parse(&unifiConfig); err != nil {
+	if err := env.ParseWithOptions(&unifiConfig, env.Options{Prefix: prefix}); err != nil {
 		return nil, fmt.Errorf("reading unifi configuration failed: %v", err)
 	}
+	unifiConfig.Tenant = tenant
+
+	if mode == configuration.ProviderModeFake {
+		log.Warn("running against a fake in-memory controller, records are lost on restart", zap.String("tenant", tenant))
+		return unifi.NewUnifiProviderWithAPI(domainFilter, targetFilter, &unifiConfig, unifi.NewMockAPI())
+	}
 
-	return unifi.NewUnifiProvider(domainFilter, &unifiConfig)
+	return unifi.NewUnifiProvider(domainFilter, targetFilter, &unifiConfig)
 }
@@ -0,0 +1,38 @@
+package doctor
+
+import (
+	"fmt"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/unifi"
+)
+
+// Run checks the connection to the UniFi controller and prints a pass/fail report.
+// It returns the process exit code.
+func Run() int {
+	config := unifi.Config{}
+	if err := env.Parse(&config); err != nil {
+		fmt.Printf("[-] configuration failed: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	for _, check := range unifi.Doctor(&config) {
+		switch {
+		case check.Skipped:
+			fmt.Printf("[ ] %s skipped\n", check.Name)
+		case check.Err != nil:
+			fmt.Printf("[-] %s failed: %v\n", check.Name, check.Err)
+			code = 1
+		default:
+			fmt.Printf("[+] %s ok: %s\n", check.Name, check.Detail)
+		}
+	}
+
+	if code == 0 {
+		fmt.Println("doctor checks passed")
+	} else {
+		fmt.Println("doctor checks failed")
+	}
+	return code
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/configuration"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/kube"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/unifi"
+	"go.uber.org/zap"
+)
+
+// component is the source of the reported events.
+const component = "external-dns-unifi-webhook"
+
+// Init reports provider failures as Kubernetes events on the pod of the webhook when enabled.
+// The pod is named by POD_NAME, POD_NAMESPACE and POD_UID, set through the downward API.
+func Init(config configuration.Config) error {
+	if !config.KubernetesEvents {
+		return nil
+	}
+
+	client, err := kube.InCluster()
+	if err != nil {
+		return fmt.Errorf("kubernetes events: %w", err)
+	}
+
+	pod := kube.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  os.Getenv("POD_NAMESPACE"),
+		Name:       os.Getenv("POD_NAME"),
+		UID:        os.Getenv("POD_UID"),
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = client.Namespace
+	}
+	if pod.Name == "" {
+		if pod.Name, err = os.Hostname(); err != nil {
+			return fmt.Errorf("kubernetes events: failed to determine the pod name: %w", err)
+		}
+	}
+
+	log.Info("reporting failures as kubernetes events", zap.String("namespace", pod.Namespace), zap.String("pod", pod.Name))
+	recorder := kube.NewEventRecorder(client, pod, component, 5*time.Minute)
+	unifi.RecordEvent = recorder.Warning
+	return nil
+}
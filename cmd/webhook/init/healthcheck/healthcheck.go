@@ -0,0 +1,44 @@
+package healthcheck
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/server"
+)
+
+// Run queries the health server of the running webhook and returns the process exit code,
+// 0 when it answers healthy. With -ready the readiness is checked instead of the liveness.
+// It lets images without a shell or HTTP client define a container health check.
+func Run(args []string) int {
+	flags := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	ready := flags.Bool("ready", false, "check the readiness instead of the liveness")
+	timeout := flags.Duration("timeout", 5*time.Second, "time to wait for the health server")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	path := "/healthz"
+	if *ready {
+		path = "/readyz"
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d%s", server.HealthPort, path))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "health check failed: %s answered %d: %s\n", path, resp.StatusCode, body)
+		return 1
+	}
+	return 0
+}
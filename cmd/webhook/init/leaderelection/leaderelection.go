@@ -0,0 +1,55 @@
+package leaderelection
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/configuration"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/kube"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/unifi"
+	"go.uber.org/zap"
+)
+
+// Init starts competing for the leader lease when leader election is enabled, and
+// restricts the mutations of the providers to the leader. It returns nil when disabled.
+func Init(config configuration.Config) (*kube.Elector, error) {
+	if !config.LeaderElection {
+		return nil, nil
+	}
+
+	client, err := kube.InCluster()
+	if err != nil {
+		return nil, fmt.Errorf("leader election: %w", err)
+	}
+
+	namespace := config.LeaderElectionNamespace
+	if namespace == "" {
+		namespace = client.Namespace
+	}
+
+	// The pod name is the hostname of the container unless POD_NAME is set through the downward API.
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("leader election: failed to determine the identity: %w", err)
+		}
+	}
+
+	elector, err := kube.NewElector(client, kube.ElectorConfig{
+		Namespace:     namespace,
+		Name:          config.LeaderElectionLeaseName,
+		Identity:      identity,
+		LeaseDuration: config.LeaderElectionLeaseDuration,
+		RenewDeadline: config.LeaderElectionRenewDeadline,
+		RetryPeriod:   config.LeaderElectionRetryPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("starting leader election", zap.String("namespace", namespace), zap.String("lease", config.LeaderElectionLeaseName), zap.String("identity", identity))
+	unifi.IsLeader = elector.IsLeader
+	elector.Start()
+	return elector, nil
+}
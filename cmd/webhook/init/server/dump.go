@@ -0,0 +1,27 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
+)
+
+// DumpStateOnSignal logs a snapshot of the provider states whenever SIGUSR1 is received
+func DumpStateOnSignal(hooks map[string]*webhook.Webhook) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+
+	go func() {
+		for range sigCh {
+			log.Info("received SIGUSR1, dumping state")
+			for _, name := range tenantNames(hooks) {
+				hooks[name].DumpState()
+			}
+		}
+	}()
+}
@@ -0,0 +1,6 @@
+package server
+
+import "github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
+
+// DumpStateOnSignal is a no-op as SIGUSR1 does not exist on windows
+func DumpStateOnSignal(hooks map[string]*webhook.Webhook) {}
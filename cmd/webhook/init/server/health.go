@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/configuration"
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
+)
+
+// HealthCheck is a named check of a single component.
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
+// healthChecks returns the checks reported by the verbose health endpoint.
+func healthChecks(config configuration.Config, mainAddr string, hooks map[string]*webhook.Webhook) []HealthCheck {
+	checks := []HealthCheck{
+		{Name: "config", Check: config.Validate},
+		{Name: "webhook", Check: func() error {
+			conn, err := net.DialTimeout("tcp", mainAddr, time.Second)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}},
+	}
+
+	for _, tenant := range tenantNames(hooks) {
+		providerChecks := hooks[tenant].HealthChecks()
+		names := make([]string, 0, len(providerChecks))
+		for name := range providerChecks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			checks = append(checks, HealthCheck{Name: tenantCheckName(tenant, name), Check: providerChecks[name]})
+		}
+	}
+
+	return checks
+}
+
+// HealthCheckHandler returns the status of the service.
+// With ?verbose=1 every component check is run and reported in the style of the kube-apiserver.
+func HealthCheckHandler(checks []HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("verbose") == "" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+			return
+		}
+
+		var b strings.Builder
+		failed := false
+		for _, check := range checks {
+			start := time.Now()
+			err := check.Check()
+			latency := time.Since(start).Round(time.Microsecond)
+
+			if err != nil {
+				failed = true
+				fmt.Fprintf(&b, "[-]%s failed: %v (%s)\n", check.Name, err, latency)
+				continue
+			}
+			fmt.Fprintf(&b, "[+]%s ok (%s)\n", check.Name, latency)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failed {
+			b.WriteString("healthz check failed\n")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			b.WriteString("healthz check passed\n")
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write([]byte(b.String()))
+	}
+}
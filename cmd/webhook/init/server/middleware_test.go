@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// slowProvider applies a change every interval until its context ends.
+type slowProvider struct {
+	provider.BaseProvider
+	interval time.Duration
+	applied  atomic.Int64
+}
+
+func (p *slowProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	return nil, nil
+}
+
+func (p *slowProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		time.Sleep(p.interval)
+		p.applied.Add(1)
+	}
+}
+
+func TestDeadlineWaitsForChanges(t *testing.T) {
+	p := &slowProvider{interval: 10 * time.Millisecond}
+	handler := deadline(50 * time.Millisecond)(http.HandlerFunc(webhook.New(p).ApplyChanges))
+
+	req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/external.dns.webhook+json;version=1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	applied := p.applied.Load()
+	time.Sleep(5 * p.interval)
+	if p.applied.Load() != applied {
+		t.Errorf("changes applied after the response: %d, then %d", applied, p.applied.Load())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		cancel     bool
+		wantStatus int
+	}{
+		{name: "deadline exceeded", wantStatus: http.StatusGatewayTimeout},
+		{name: "client canceled", cancel: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := timeout(50 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			}))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records", nil).WithContext(ctx))
+
+			// The recorder reports 200 when nothing was written.
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.cancel && rec.Body.Len() != 0 {
+				t.Errorf("response written to a canceled client: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestSelfSignedCertificateLeaf(t *testing.T) {
+	cert, err := selfSignedCertificate([]string{"127.0.0.1", "webhook.local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		t.Fatal("certificate has no parsed leaf")
+	}
+	if !bytes.Equal(leaf.Raw, cert.Certificate[0]) {
+		t.Error("leaf does not hold the encoded certificate")
+	}
+	if err := leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+		t.Errorf("leaf is not self-signed: %v", err)
+	}
+	if !slices.Equal(leaf.DNSNames, []string{"webhook.local"}) {
+		t.Errorf("DNS names %v, want [webhook.local]", leaf.DNSNames)
+	}
+	if len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("IP addresses %v, want [127.0.0.1]", leaf.IPAddresses)
+	}
+}
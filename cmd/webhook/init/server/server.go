@@ -2,57 +2,159 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/configuration"
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/buildinfo"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/envconfig"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/sdnotify"
 	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"go.uber.org/zap"
 )
 
-// HealthCheckHandler returns the status of the service
-func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// ReadinessHandler returns whether every tenant is ready to accept requests. Degraded
+// tenants still accept requests, so they answer 200 with the reasons in the body.
+func ReadinessHandler(hooks map[string]*webhook.Webhook) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var degraded []string
+		var notReady []string
+		for _, name := range tenantNames(hooks) {
+			state, err := hooks[name].Readiness()
+			for _, s := range []string{webhook.ReadinessReady, webhook.ReadinessDegraded, webhook.ReadinessNotReady} {
+				value := 0.0
+				if s == state {
+					value = 1
+				}
+				metrics.ReadinessState.WithLabelValues(name, s).Set(value)
+			}
+
+			switch state {
+			case webhook.ReadinessNotReady:
+				notReady = append(notReady, tenantCheckName(name, err.Error()))
+			case webhook.ReadinessDegraded:
+				degraded = append(degraded, tenantCheckName(name, err.Error()))
+			}
+		}
+
+		switch {
+		case len(notReady) > 0:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(strings.Join(notReady, "\n")))
+		case len(degraded) > 0:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("degraded: " + strings.Join(degraded, "\n")))
+		default:
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+		}
+	}
 }
 
-// ReadinessHandler returns whether the service is ready to accept requests
-func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+// VersionHandler returns the build information of the webhook
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildinfo.Get()); err != nil {
+		log.Error("error encoding version", zap.Error(err))
+	}
 }
 
-// Init initializes the http server
-func Init(config configuration.Config, p *webhook.Webhook) (*http.Server, *http.Server) {
+// ConfigHandler returns the effective configuration of the process and of every tenant, with secrets
+// masked. The variables of a tenant are listed without its prefix.
+func ConfigHandler(config configuration.Config, hooks map[string]*webhook.Webhook) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenants := map[string]any{}
+		for name, hook := range hooks {
+			tenants[name] = hook.EffectiveConfig()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"process": envconfig.Describe(config),
+			"tenants": tenants,
+		}); err != nil {
+			log.Error("error encoding configuration", zap.Error(err))
+		}
+	}
+}
+
+// Init initializes the http server. Webhooks are keyed by tenant name, the webhook of the
+// empty tenant is served at the root and every other tenant under its name as path prefix.
+func Init(config configuration.Config, hooks map[string]*webhook.Webhook) (*http.Server, *http.Server) {
 	mainRouter := chi.NewRouter()
-	mainRouter.Get("/", p.Negotiate)
-	mainRouter.Get("/records", p.Records)
-	mainRouter.Post("/records", p.ApplyChanges)
-	mainRouter.Post("/adjustendpoints", p.AdjustEndpoints)
+	mainRouter.Use(middleware.RequestID)
+	mainRouter.Use(observeDuration)
+	mainRouter.Use(decompressRequest)
+	mainRouter.Use(limitRequestBody(config.ServerMaxRequestBodySize))
+	mainRouter.Use(middleware.Compress(5, "application/external.dns.webhook+json", "application/json", "text/plain"))
+	mountTenants(mainRouter, hooks, func(r chi.Router, p *webhook.Webhook) {
+		r.Get("/", p.Negotiate)
+		r.With(timeout(config.ServerRecordsTimeout)).Get("/records", p.Records)
+		r.With(deadline(config.ServerApplyChangesTimeout)).Post("/records", p.ApplyChanges)
+		r.With(timeout(config.ServerAdjustEndpointsTimeout)).Post("/adjustendpoints", p.AdjustEndpoints)
+	})
 
 	mainServer := createHTTPServer(fmt.Sprintf("%s:%d", config.ServerHost, config.ServerPort), mainRouter, config.ServerReadTimeout, config.ServerWriteTimeout)
+	if config.ServerTLSCertFile != "" || config.ServerTLSKeyFile != "" {
+		reloader, err := newCertReloader(config.ServerTLSCertFile, config.ServerTLSKeyFile)
+		if err != nil {
+			log.Fatal("unable to load the webhook server certificate", zap.Error(err))
+		}
+		go reloader.watch(config.ServerTLSReloadInterval)
+		reloader.reloadOnSignal()
+		sighupReloadsCertificate = true
+		mainServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	} else if config.ServerTLSSelfSigned {
+		cert, err := selfSignedCertificate(config.ServerTLSSelfSignedSANs)
+		if err != nil {
+			log.Fatal("unable to generate the webhook server certificate", zap.Error(err))
+		}
+		log.Info("generated a self-signed webhook server certificate", zap.Strings("sans", config.ServerTLSSelfSignedSANs), zap.String("sha256", certificateFingerprint(cert)))
+		mainServer.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*cert},
+		}
+	}
 	go func() {
-		log.Info("starting webhook server", zap.String("address", mainServer.Addr))
-		if err := mainServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Info("starting webhook server", zap.String("address", mainServer.Addr), zap.Bool("tls", mainServer.TLSConfig != nil))
+		if err := listenAndServe(mainServer); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("unable to start webhook server", zap.String("address", mainServer.Addr), zap.Error(err))
 		}
 	}()
 
 	healthRouter := chi.NewRouter()
+	healthRouter.Use(middleware.RequestID)
 	healthRouter.Get("/metrics", promhttp.Handler().ServeHTTP)
-	healthRouter.Get("/healthz", HealthCheckHandler)
-	healthRouter.Get("/readyz", ReadinessHandler)
+	healthRouter.Get("/healthz", HealthCheckHandler(healthChecks(config, mainServer.Addr, hooks)))
+	healthRouter.Get("/readyz", ReadinessHandler(hooks))
+	healthRouter.Get("/version", VersionHandler)
+	healthRouter.Get("/config", ConfigHandler(config, hooks))
+	mountTenants(healthRouter, hooks, func(r chi.Router, p *webhook.Webhook) {
+		r.Get("/status", p.Status)
+		r.Get("/last-apply", p.LastApply)
+		r.With(requireToken(config.ServerDebugToken)).Get("/debug/unifi-records", p.DebugRecords)
+		r.With(requireAdminToken(config.ServerAdminToken)).Post("/admin/prune-duplicates", p.PruneDuplicates)
+	})
 
-	healthServer := createHTTPServer("0.0.0.0:8080", healthRouter, config.ServerReadTimeout, config.ServerWriteTimeout)
+	healthServer := createHTTPServer(fmt.Sprintf("0.0.0.0:%d", HealthPort), healthRouter, config.ServerReadTimeout, config.ServerWriteTimeout)
 	go func() {
 		log.Info("starting health server", zap.String("address", healthServer.Addr))
 		if err := healthServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -63,6 +165,46 @@ func Init(config configuration.Config, p *webhook.Webhook) (*http.Server, *http.
 	return mainServer, healthServer
 }
 
+// mountTenants registers the routes of every tenant, under its name unless it is the default tenant.
+func mountTenants(router chi.Router, hooks map[string]*webhook.Webhook, routes func(r chi.Router, p *webhook.Webhook)) {
+	for _, name := range tenantNames(hooks) {
+		p := hooks[name]
+		if name == "" {
+			routes(router, p)
+			continue
+		}
+		router.Route("/"+name, func(r chi.Router) {
+			routes(r, p)
+		})
+	}
+}
+
+// tenantNames returns the sorted tenant names.
+func tenantNames(hooks map[string]*webhook.Webhook) []string {
+	names := make([]string, 0, len(hooks))
+	for name := range hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tenantCheckName prefixes a check or message with the tenant name, if any.
+func tenantCheckName(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	return tenant + "/" + name
+}
+
+// listenAndServe serves TLS when the server has a TLS configuration.
+func listenAndServe(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
 func createHTTPServer(addr string, hand http.Handler, readTimeout, writeTimeout time.Duration) *http.Server {
 	return &http.Server{
 		ReadTimeout:  readTimeout,
@@ -72,21 +214,58 @@ func createHTTPServer(addr string, hand http.Handler, readTimeout, writeTimeout
 	}
 }
 
-// ShutdownGracefully gracefully shutdown the http server
-func ShutdownGracefully(mainServer *http.Server, healthServer *http.Server) {
+// HealthPort is the port of the health server.
+const HealthPort = 8080
+
+// healthShutdownTimeout bounds closing the health server once the webhook server stopped.
+const healthShutdownTimeout = 5 * time.Second
+
+// sighupReloadsCertificate is set by Init when SIGHUP reloads the certificate files of the webhook server.
+var sighupReloadsCertificate bool
+
+// shutdownSignals returns the signals shutting down the servers. SIGHUP is left to the certificate
+// reloader when one is installed.
+func shutdownSignals() []os.Signal {
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+	if !sighupReloadsCertificate {
+		signals = append(signals, syscall.SIGHUP)
+	}
+	return signals
+}
+
+// ShutdownGracefully gracefully shutdown the http server. In-flight changes are drained and the
+// webhook server is shut down within the timeout, a timeout of 0 waits indefinitely. The health
+// server is only shut down afterwards, so probes keep answering while requests drain.
+func ShutdownGracefully(hooks map[string]*webhook.Webhook, mainServer *http.Server, healthServer *http.Server, timeout time.Duration) {
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(sigCh, shutdownSignals()...)
 	sig := <-sigCh
 
-	log.Info("shutting down servers due to received signal", zap.Any("signal", sig))
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	log.Info("shutting down servers due to received signal", zap.Any("signal", sig), zap.Duration("timeout", timeout))
+	if err := sdnotify.Notify(sdnotify.Stopping); err != nil {
+		log.Error("failed to notify systemd", zap.Error(err))
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Readiness reports not ready while in-flight changes are drained.
+	for _, name := range tenantNames(hooks) {
+		if err := hooks[name].Drain(ctx); err != nil {
+			log.Error("timed out waiting for in-flight changes", zap.String("tenant", name), zap.Error(err))
+		}
+	}
 
 	if err := mainServer.Shutdown(ctx); err != nil {
 		log.Error("error shutting down main server", zap.Error(err))
 	}
 
-	if err := healthServer.Shutdown(ctx); err != nil {
+	healthCtx, healthCancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+	defer healthCancel()
+	if err := healthServer.Shutdown(healthCtx); err != nil {
 		log.Error("error shutting down health server", zap.Error(err))
 	}
 }
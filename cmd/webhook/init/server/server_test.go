@@ -0,0 +1,22 @@
+package server
+
+import (
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+func TestShutdownSignalsLeaveSIGHUPToTheReloader(t *testing.T) {
+	t.Cleanup(func() { sighupReloadsCertificate = false })
+
+	for _, reloader := range []bool{false, true} {
+		sighupReloadsCertificate = reloader
+		if got := slices.Contains(shutdownSignals(), os.Signal(syscall.SIGHUP)); got == reloader {
+			t.Errorf("with reloader %t: SIGHUP shuts down = %t", reloader, got)
+		}
+		if !slices.Contains(shutdownSignals(), os.Signal(syscall.SIGTERM)) {
+			t.Errorf("with reloader %t: SIGTERM does not shut down", reloader)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+// certReloader serves the TLS certificate from disk and reloads it when the files change,
+// so rotated certificates are picked up by new handshakes without dropping open connections.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newCertReloader loads the certificate and key.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload re-reads the certificate and key and reports whether they changed.
+// A pair that cannot be loaded leaves the current certificate in place.
+func (r *certReloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read tls certificate %s: %w", r.certFile, err)
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read tls key %s: %w", r.keyFile, err)
+	}
+
+	r.mu.RLock()
+	unchanged := bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	// The certificate and key are written separately on rotation, a mismatch is retried later.
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("failed to load tls key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	return true, nil
+}
+
+// GetCertificate returns the current certificate for a TLS handshake.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reloadAndLog reloads the certificate, logging the outcome.
+func (r *certReloader) reloadAndLog(trigger string) {
+	changed, err := r.reload()
+	if err != nil {
+		log.Error("failed to reload the tls certificate, keeping the current one", zap.String("trigger", trigger), zap.Error(err))
+		return
+	}
+	if changed {
+		log.Info("reloaded the tls certificate", zap.String("trigger", trigger), zap.String("cert_file", r.certFile))
+	}
+}
+
+// watch periodically reloads the certificate.
+func (r *certReloader) watch(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.reloadAndLog("interval")
+	}
+}
+
+// reloadOnSignal reloads the certificate whenever SIGHUP is received.
+func (r *certReloader) reloadOnSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		for range sigCh {
+			r.reloadAndLog("SIGHUP")
+		}
+	}()
+}
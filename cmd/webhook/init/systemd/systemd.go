@@ -0,0 +1,65 @@
+package systemd
+
+import (
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/sdnotify"
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
+	"go.uber.org/zap"
+)
+
+// readyPollInterval is how often the webhooks are checked until all of them are ready.
+const readyPollInterval = time.Second
+
+// Init notifies systemd once every webhook reached the controller and pings the watchdog, when
+// started by a unit of Type=notify. It does nothing outside of systemd.
+func Init(hooks map[string]*webhook.Webhook) {
+	if !sdnotify.Enabled() {
+		return
+	}
+
+	if interval := sdnotify.WatchdogInterval(); interval > 0 {
+		log.Info("pinging the systemd watchdog", zap.Duration("interval", interval/2))
+		go watchdog(interval / 2)
+	}
+	go notifyReady(hooks)
+}
+
+// notifyReady sends READY=1 once every webhook is ready, which requires a successful connection
+// to its controller.
+func notifyReady(hooks map[string]*webhook.Webhook) {
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	for !allReady(hooks) {
+		<-ticker.C
+	}
+
+	if err := sdnotify.Notify(sdnotify.Ready + "\nSTATUS=connected to the unifi controller"); err != nil {
+		log.Error("failed to notify systemd", zap.Error(err))
+		return
+	}
+	log.Info("notified systemd the webhook is ready")
+}
+
+func allReady(hooks map[string]*webhook.Webhook) bool {
+	for _, hook := range hooks {
+		if hook.Ready() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// watchdog pings the systemd watchdog for as long as the process runs.
+func watchdog(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := sdnotify.Notify(sdnotify.Watchdog); err != nil {
+			log.Error("failed to ping the systemd watchdog", zap.Error(err))
+		}
+	}
+}
@@ -1,39 +1,76 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/configuration"
 	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/dnsprovider"
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/doctor"
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/events"
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/healthcheck"
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/leaderelection"
 	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/server"
+	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/systemd"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/buildinfo"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
 	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
 
 	"go.uber.org/zap"
 )
 
-const banner = `
-external-dns-provider-unifi
-version: %s (%s)
-
-`
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Print(buildinfo.Get())
+		os.Exit(0)
+	}
 
-var (
-	Version = "local"
-	Gitsha  = "?"
-)
+	// The health check runs periodically, it does not print the banner.
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(healthcheck.Run(os.Args[2:]))
+	}
 
-func main() {
-	fmt.Printf(banner, Version, Gitsha)
+	fmt.Print(buildinfo.Banner())
 
 	log.Init()
+	buildinfo.Register()
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(doctor.Run())
+	}
 
 	config := configuration.Init()
-	provider, err := dnsprovider.Init(config)
+	if err := metrics.SetDurationBuckets(config.MetricsUnifiAPIBuckets, config.MetricsHTTPRequestBuckets); err != nil {
+		log.Fatal("invalid metrics configuration", zap.Error(err))
+	}
+	if err := events.Init(config); err != nil {
+		log.Fatal("failed to initialize kubernetes events", zap.Error(err))
+	}
+	elector, err := leaderelection.Init(config)
+	if err != nil {
+		log.Fatal("failed to initialize leader election", zap.Error(err))
+	}
+
+	providers, err := dnsprovider.Init(config)
 	if err != nil {
 		log.Fatal("failed to initialize provider", zap.Error(err))
 	}
 
-	main, health := server.Init(config, webhook.New(provider))
-	server.ShutdownGracefully(main, health)
+	hooks := map[string]*webhook.Webhook{}
+	for tenant, provider := range providers {
+		hooks[tenant] = webhook.New(provider)
+	}
+	main, health := server.Init(config, hooks)
+	server.DumpStateOnSignal(hooks)
+	systemd.Init(hooks)
+	server.ShutdownGracefully(hooks, main, health, config.ServerShutdownTimeout)
+
+	if elector != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		elector.Stop(ctx)
+	}
 }
@@ -0,0 +1,53 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/webhook"
+)
+
+// Version and Gitsha are injected at build time with
+// -ldflags "-X github.com/kashalls/external-dns-unifi-webhook/internal/buildinfo.Version=..."
+var (
+	// Version is the release version of the build.
+	Version = "local"
+	// Gitsha is the git commit of the build.
+	Gitsha = "?"
+)
+
+// Info describes the build of the webhook.
+type Info struct {
+	Version    string   `json:"version"`
+	GitSHA     string   `json:"gitSha"`
+	GoVersion  string   `json:"goVersion"`
+	MediaTypes []string `json:"mediaTypes"`
+}
+
+// Get returns the build information.
+func Get() Info {
+	return Info{
+		Version:    Version,
+		GitSHA:     Gitsha,
+		GoVersion:  runtime.Version(),
+		MediaTypes: webhook.MediaTypes(),
+	}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("version: %s\ngit sha: %s\ngo version: %s\nmedia types: %s\n",
+		i.Version, i.GitSHA, i.GoVersion, strings.Join(i.MediaTypes, ", "))
+}
+
+// Register exposes the build information as metric.
+func Register() {
+	info := Get()
+	metrics.BuildInfo.WithLabelValues(info.Version, info.GitSHA, info.GoVersion).Set(1)
+}
+
+// Banner returns the banner printed at startup.
+func Banner() string {
+	return fmt.Sprintf("\nexternal-dns-provider-unifi\nversion: %s (%s)\n\n", Version, Gitsha)
+}
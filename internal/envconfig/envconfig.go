@@ -0,0 +1,63 @@
+// Package envconfig describes configuration structs parsed from the environment.
+package envconfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Masked replaces the value of secrets that are set.
+const Masked = "*****"
+
+// Describe returns the values of the fields of a configuration struct keyed by their environment
+// variable. Secrets, recognized by the name of their variable, are masked when set.
+func Describe(cfg any) map[string]any {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	t := v.Type()
+
+	values := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ",")
+		if name == "" || !t.Field(i).IsExported() {
+			continue
+		}
+		values[name] = value(name, v.Field(i))
+	}
+	return values
+}
+
+// IsSecret returns whether the environment variable holds a secret, judged by the suffix of its name.
+func IsSecret(name string) bool {
+	for _, suffix := range []string{"_PASS", "_PASSWORD", "_TOKEN", "_SECRET", "_API_KEY"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func value(name string, field reflect.Value) any {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	if IsSecret(name) {
+		if field.IsZero() {
+			return ""
+		}
+		return Masked
+	}
+
+	switch v := field.Interface().(type) {
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
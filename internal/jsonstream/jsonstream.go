@@ -0,0 +1,71 @@
+// Package jsonstream decodes large JSON arrays element by element, so only a single element is
+// buffered at a time instead of the whole document.
+package jsonstream
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Expect consumes the next token, which must be the delimiter.
+func Expect(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("invalid json: expected %q, got %v", delim, tok)
+	}
+	return nil
+}
+
+// DecodeArray decodes the next value, which must be an array or null, passing every element to add.
+func DecodeArray[T any](dec *json.Decoder, add func(T)) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("invalid json: expected an array, got %v", tok)
+	}
+
+	for dec.More() {
+		var element T
+		if err := dec.Decode(&element); err != nil {
+			return err
+		}
+		add(element)
+	}
+	return Expect(dec, ']')
+}
+
+// DecodeObject decodes the next value, which must be an object, calling field for every key.
+// field decodes the value of the key from the decoder, unknown keys are skipped with Skip.
+func DecodeObject(dec *json.Decoder, field func(key string) error) error {
+	if err := Expect(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid json: expected an object key, got %v", tok)
+		}
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	return Expect(dec, '}')
+}
+
+// Skip discards the next value.
+func Skip(dec *json.Decoder) error {
+	var discard json.RawMessage
+	return dec.Decode(&discard)
+}
@@ -0,0 +1,177 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// ElectorConfig configures the leader election.
+type ElectorConfig struct {
+	Namespace     string
+	Name          string
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// Elector competes for a Lease with the other replicas. Only the holder of the lease is the leader.
+type Elector struct {
+	client *Client
+	config ElectorConfig
+
+	// renewedAt is the unix nano time of the last successful acquire or renew, zero while not leading.
+	renewedAt atomic.Int64
+	leading   bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewElector returns an elector for the lease described by the config.
+func NewElector(client *Client, config ElectorConfig) (*Elector, error) {
+	if config.Identity == "" {
+		return nil, errors.New("leader election requires an identity")
+	}
+	if config.LeaseDuration <= config.RenewDeadline || config.RenewDeadline <= config.RetryPeriod || config.RetryPeriod <= 0 {
+		return nil, errors.New("leader election requires lease duration > renew deadline > retry period > 0")
+	}
+	return &Elector{client: client, config: config}, nil
+}
+
+// IsLeader returns whether the replica holds the lease. Leadership lapses once the
+// lease could not be renewed within the renew deadline, before another replica can take it.
+func (e *Elector) IsLeader() bool {
+	renewedAt := e.renewedAt.Load()
+	return renewedAt != 0 && time.Since(time.Unix(0, renewedAt)) < e.config.RenewDeadline
+}
+
+// Start competes for the lease in the background until Stop is called.
+func (e *Elector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.config.RetryPeriod)
+		defer ticker.Stop()
+
+		for {
+			if err := e.tryAcquireOrRenew(ctx); err != nil && ctx.Err() == nil {
+				log.Warn("failed to acquire or renew the leader lease", zap.String("lease", e.config.Name), zap.Error(err))
+			}
+			e.observe()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops competing for the lease and releases it when held, so another replica takes over immediately.
+func (e *Elector) Stop(ctx context.Context) {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+
+	wasLeader := e.IsLeader()
+	e.renewedAt.Store(0)
+	e.observe()
+	if !wasLeader {
+		return
+	}
+
+	lease, err := e.client.GetLease(ctx, e.config.Namespace, e.config.Name)
+	if err != nil || lease.Spec.HolderIdentity != e.config.Identity {
+		return
+	}
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	lease.Spec.RenewTime = &MicroTime{time.Now()}
+	if _, err := e.client.UpdateLease(ctx, lease); err != nil {
+		log.Warn("failed to release the leader lease", zap.String("lease", e.config.Name), zap.Error(err))
+		return
+	}
+	log.Info("released the leader lease", zap.String("lease", e.config.Name))
+}
+
+// tryAcquireOrRenew takes the lease when it is free or expired, and renews it when held.
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) error {
+	now := time.Now()
+	lease, err := e.client.GetLease(ctx, e.config.Namespace, e.config.Name)
+	if IsNotFound(err) {
+		_, err = e.client.CreateLease(ctx, &Lease{
+			Metadata: ObjectMeta{Name: e.config.Name, Namespace: e.config.Namespace},
+			Spec: LeaseSpec{
+				HolderIdentity:       e.config.Identity,
+				LeaseDurationSeconds: int(e.config.LeaseDuration.Seconds()),
+				AcquireTime:          &MicroTime{now},
+				RenewTime:            &MicroTime{now},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		e.renewedAt.Store(now.UnixNano())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	holder := lease.Spec.HolderIdentity
+	if holder != "" && holder != e.config.Identity && lease.Spec.RenewTime != nil {
+		expiry := lease.Spec.RenewTime.Add(time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second)
+		if now.Before(expiry) {
+			e.renewedAt.Store(0)
+			return nil
+		}
+	}
+
+	if holder != e.config.Identity {
+		lease.Spec.AcquireTime = &MicroTime{now}
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.HolderIdentity = e.config.Identity
+	lease.Spec.LeaseDurationSeconds = int(e.config.LeaseDuration.Seconds())
+	lease.Spec.RenewTime = &MicroTime{now}
+
+	// A conflict means another replica updated the lease since it was read.
+	if _, err := e.client.UpdateLease(ctx, lease); err != nil {
+		if IsConflict(err) {
+			e.renewedAt.Store(0)
+		}
+		return err
+	}
+	e.renewedAt.Store(now.UnixNano())
+	return nil
+}
+
+// observe logs and reports leadership changes.
+func (e *Elector) observe() {
+	leading := e.IsLeader()
+	if leading == e.leading {
+		return
+	}
+	e.leading = leading
+
+	if leading {
+		log.Info("became the leader, applying changes", zap.String("lease", e.config.Name), zap.String("identity", e.config.Identity))
+		metrics.Leader.Set(1)
+		return
+	}
+	log.Info("lost the leadership, serving records read-only", zap.String("lease", e.config.Name), zap.String("identity", e.config.Identity))
+	metrics.Leader.Set(0)
+}
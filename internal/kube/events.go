@@ -0,0 +1,115 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+// ObjectReference identifies the object an event is about.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+}
+
+// EventSource identifies the component reporting an event.
+type EventSource struct {
+	Component string `json:"component,omitempty"`
+	Host      string `json:"host,omitempty"`
+}
+
+// EventMeta is the metadata of an event, named by the API server from the prefix.
+type EventMeta struct {
+	GenerateName string `json:"generateName"`
+	Namespace    string `json:"namespace"`
+}
+
+// Event is a core/v1 Event.
+type Event struct {
+	APIVersion          string          `json:"apiVersion"`
+	Kind                string          `json:"kind"`
+	Metadata            EventMeta       `json:"metadata"`
+	InvolvedObject      ObjectReference `json:"involvedObject"`
+	Reason              string          `json:"reason"`
+	Message             string          `json:"message"`
+	Type                string          `json:"type"`
+	Source              EventSource     `json:"source"`
+	FirstTimestamp      time.Time       `json:"firstTimestamp"`
+	LastTimestamp       time.Time       `json:"lastTimestamp"`
+	Count               int             `json:"count"`
+	ReportingController string          `json:"reportingComponent,omitempty"`
+	ReportingInstance   string          `json:"reportingInstance,omitempty"`
+}
+
+// CreateEvent creates the event.
+func (c *Client) CreateEvent(ctx context.Context, event *Event) error {
+	event.APIVersion, event.Kind = "v1", "Event"
+	path := "/api/v1/namespaces/" + url.PathEscape(event.Metadata.Namespace) + "/events"
+	return c.do(ctx, http.MethodPost, path, event, nil)
+}
+
+// EventRecorder reports warning events on an object. Repeated events of the same
+// reason are dropped within the interval so a failure loop cannot flood the API server.
+type EventRecorder struct {
+	client    *Client
+	object    ObjectReference
+	component string
+	interval  time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// NewEventRecorder returns a recorder of events on the object, reported by the component.
+func NewEventRecorder(client *Client, object ObjectReference, component string, interval time.Duration) *EventRecorder {
+	return &EventRecorder{
+		client:    client,
+		object:    object,
+		component: component,
+		interval:  interval,
+		last:      map[string]time.Time{},
+	}
+}
+
+// Warning reports a warning event in the background.
+func (r *EventRecorder) Warning(reason, message string) {
+	now := time.Now()
+
+	r.mu.Lock()
+	if last, ok := r.last[reason]; ok && now.Sub(last) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.last[reason] = now
+	r.mu.Unlock()
+
+	event := &Event{
+		Metadata:            EventMeta{GenerateName: r.object.Name + ".", Namespace: r.object.Namespace},
+		InvolvedObject:      r.object,
+		Reason:              reason,
+		Message:             message,
+		Type:                "Warning",
+		Source:              EventSource{Component: r.component},
+		FirstTimestamp:      now.UTC(),
+		LastTimestamp:       now.UTC(),
+		Count:               1,
+		ReportingController: r.component,
+		ReportingInstance:   r.object.Name,
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := r.client.CreateEvent(ctx, event); err != nil {
+			log.Warn("failed to create kubernetes event", zap.String("reason", reason), zap.Error(err))
+		}
+	}()
+}
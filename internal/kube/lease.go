@@ -0,0 +1,91 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// microTimeFormat is the serialization of the Kubernetes MicroTime type.
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// MicroTime is a timestamp with microsecond precision.
+type MicroTime struct {
+	time.Time
+}
+
+func (t MicroTime) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.UTC().Format(microTimeFormat) + `"`), nil
+}
+
+func (t *MicroTime) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	parsed, err := time.Parse(`"`+time.RFC3339Nano+`"`, string(b))
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// ObjectMeta is the subset of the object metadata used by the webhook.
+type ObjectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// Lease is a coordination.k8s.io/v1 Lease.
+type Lease struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       LeaseSpec  `json:"spec"`
+}
+
+// LeaseSpec is the specification of a Lease.
+type LeaseSpec struct {
+	HolderIdentity       string     `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int        `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *MicroTime `json:"renewTime,omitempty"`
+	LeaseTransitions     int        `json:"leaseTransitions,omitempty"`
+}
+
+func leasesPath(namespace string) string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", url.PathEscape(namespace))
+}
+
+// GetLease returns the lease.
+func (c *Client) GetLease(ctx context.Context, namespace, name string) (*Lease, error) {
+	lease := &Lease{}
+	if err := c.do(ctx, http.MethodGet, leasesPath(namespace)+"/"+url.PathEscape(name), nil, lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// CreateLease creates the lease.
+func (c *Client) CreateLease(ctx context.Context, lease *Lease) (*Lease, error) {
+	lease.APIVersion, lease.Kind = "coordination.k8s.io/v1", "Lease"
+	created := &Lease{}
+	if err := c.do(ctx, http.MethodPost, leasesPath(lease.Metadata.Namespace), lease, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateLease replaces the lease. The update fails with a conflict when the
+// resource version changed since the lease was read.
+func (c *Client) UpdateLease(ctx context.Context, lease *Lease) (*Lease, error) {
+	lease.APIVersion, lease.Kind = "coordination.k8s.io/v1", "Lease"
+	updated := &Lease{}
+	if err := c.do(ctx, http.MethodPut, leasesPath(lease.Metadata.Namespace)+"/"+url.PathEscape(lease.Metadata.Name), lease, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
@@ -6,7 +6,13 @@ import (
 	"go.uber.org/zap"
 )
 
-var logger *zap.Logger
+// logger discards everything until Init or SetLogger is called.
+var logger = zap.NewNop()
+
+// SetLogger replaces the logger, for programs embedding the webhook packages.
+func SetLogger(l *zap.Logger) {
+	logger = l
+}
 
 func Init() {
 	config := zap.NewProductionConfig()
@@ -53,6 +59,10 @@ func Debug(message string, fields ...zap.Field) {
 	logger.Debug(message, fields...)
 }
 
+func Warn(message string, fields ...zap.Field) {
+	logger.Warn(message, fields...)
+}
+
 func Error(message string, fields ...zap.Field) {
 	logger.Error(message, fields...)
 }
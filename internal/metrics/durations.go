@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The duration histograms are not registered through promauto, so their buckets can be
+// replaced once the configuration is known.
+var (
+	// UnifiAPIDuration observes the duration of the requests sent to the UniFi controller.
+	UnifiAPIDuration = newUnifiAPIDuration(prometheus.DefBuckets)
+
+	// HTTPRequestDuration observes the duration of the requests served by the webhook.
+	HTTPRequestDuration = newHTTPRequestDuration(prometheus.DefBuckets)
+)
+
+func init() {
+	prometheus.MustRegister(UnifiAPIDuration, HTTPRequestDuration)
+}
+
+func newUnifiAPIDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "unifi_api_duration_seconds",
+		Help:      "Duration of the requests sent to the UniFi controller by method and status code.",
+		Buckets:   buckets,
+	}, []string{"method", "code"})
+}
+
+func newHTTPRequestDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the requests served by the webhook by route, method and status code.",
+		Buckets:   buckets,
+	}, []string{"route", "method", "code"})
+}
+
+// SetDurationBuckets replaces the buckets of the duration histograms, empty buckets keep the
+// defaults. It must be called at startup, before any duration is observed.
+func SetDurationBuckets(unifiAPI, httpRequest []float64) error {
+	if err := validateBuckets(unifiAPI); err != nil {
+		return fmt.Errorf("invalid unifi api duration buckets: %w", err)
+	}
+	if err := validateBuckets(httpRequest); err != nil {
+		return fmt.Errorf("invalid http request duration buckets: %w", err)
+	}
+
+	if len(unifiAPI) > 0 {
+		prometheus.Unregister(UnifiAPIDuration)
+		UnifiAPIDuration = newUnifiAPIDuration(unifiAPI)
+		prometheus.MustRegister(UnifiAPIDuration)
+	}
+	if len(httpRequest) > 0 {
+		prometheus.Unregister(HTTPRequestDuration)
+		HTTPRequestDuration = newHTTPRequestDuration(httpRequest)
+		prometheus.MustRegister(HTTPRequestDuration)
+	}
+	return nil
+}
+
+func validateBuckets(buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("%v is not strictly increasing", buckets)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "external_dns_unifi"
+
+var (
+	// BuildInfo exposes the build of the running webhook.
+	BuildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information of the running webhook, always 1.",
+	}, []string{"version", "gitsha", "goversion"})
+
+	// InstanceInfo exposes the persistent identity of this webhook instance.
+	InstanceInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "instance_info",
+		Help:      "Information about the running webhook instance, always 1.",
+	}, []string{"instance_id"})
+
+	// CNAMEConflictsTotal counts names for which a plan would leave a CNAME alongside other records.
+	CNAMEConflictsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cname_conflicts_total",
+		Help:      "Number of CNAME conflicts found in incoming plans.",
+	})
+
+	// ControllerCNAMEConflicts reports names on the controller holding a CNAME alongside other records.
+	ControllerCNAMEConflicts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "controller_cname_conflicts",
+		Help:      "Number of names on the controller holding a CNAME alongside other record types.",
+	}, []string{"tenant"})
+
+	// WildcardEndpointsSkippedTotal counts wildcard endpoints that could not be written to the controller.
+	WildcardEndpointsSkippedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "wildcard_endpoints_skipped_total",
+		Help:      "Number of wildcard endpoints skipped because UniFi does not support them.",
+	}, []string{"record_type"})
+
+	// ConsecutiveErrors reports the number of provider operations that failed in a row.
+	ConsecutiveErrors = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consecutive_errors",
+		Help:      "Number of consecutive failed provider operations.",
+	}, []string{"tenant"})
+
+	// PlansRejectedTotal counts plans refused before any change was applied.
+	PlansRejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "plans_rejected_total",
+		Help:      "Number of plans rejected before applying any change.",
+	}, []string{"reason"})
+
+	// DeletesSkippedTotal counts deletes skipped because deletions are disabled.
+	DeletesSkippedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deletes_skipped_total",
+		Help:      "Number of deletes skipped because deletions are disabled.",
+	})
+
+	// LastPlanChanges reports the number of changes per action of the most recent plan.
+	LastPlanChanges = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_plan_changes",
+		Help:      "Number of changes per action in the most recent plan.",
+	}, []string{"tenant", "action"})
+
+	// LastPlanSuccess reports whether the most recent plan was applied successfully.
+	LastPlanSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_plan_success",
+		Help:      "Whether the most recent plan was applied successfully (1) or failed (0).",
+	}, []string{"tenant"})
+
+	// LastPlanTimestamp reports when the most recent plan finished.
+	LastPlanTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_plan_timestamp_seconds",
+		Help:      "Unix timestamp of the most recent plan.",
+	}, []string{"tenant"})
+
+	// RateLimitedTotal counts responses where the controller asked the client to back off.
+	RateLimitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Number of requests rate limited by the UniFi controller.",
+	})
+
+	// RecordsRepairedTotal counts records recreated by the background reconcile.
+	RecordsRepairedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_repaired_total",
+		Help:      "Number of records recreated after disappearing from the UniFi controller.",
+	})
+
+	// UnsupportedEndpointsSkippedTotal counts endpoints dropped because UniFi cannot store their record type.
+	UnsupportedEndpointsSkippedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unsupported_endpoints_skipped_total",
+		Help:      "Number of endpoints skipped because their record type is not supported by UniFi.",
+	}, []string{"record_type"})
+
+	// RecordIndexSize reports the number of records in the record ID index.
+	RecordIndexSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "record_index_size",
+		Help:      "Number of records in the record ID index.",
+	}, []string{"tenant"})
+
+	// ErrorsTotal counts failed provider operations by error class.
+	ErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Number of failed provider operations by error class (auth, network, api, data, rate_limit, rejected, other).",
+	}, []string{"error_class"})
+
+	// LoginFailuresTotal counts logins rejected by the controller.
+	LoginFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Number of logins rejected by the UniFi controller.",
+	})
+
+	// LoginDisabledUntil reports until when logins are backing off after rejected attempts.
+	LoginDisabledUntil = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "login_disabled_until_timestamp_seconds",
+		Help:      "Unix timestamp until which logins are disabled after rejected attempts, 0 when logins are allowed.",
+	}, []string{"tenant"})
+
+	// DuplicatesRemovedTotal counts duplicate records deleted from the controller.
+	DuplicatesRemovedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_removed_total",
+		Help:      "Number of exact duplicate records deleted from the UniFi controller.",
+	})
+
+	// DuplicateRecords reports the exact duplicate records found by the most recent sync.
+	DuplicateRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "duplicate_records",
+		Help:      "Number of exact duplicate records found on the UniFi controller by the most recent sync.",
+	}, []string{"tenant"})
+
+	// Leader reports whether this replica holds the leader election lease.
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "Whether this replica holds the leader election lease and applies changes.",
+	})
+
+	// RecordConflictsTotal counts operations aborted because the record changed on the controller.
+	RecordConflictsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_conflicts_total",
+		Help:      "Number of record deletes and updates aborted because the record changed on the controller since it was looked up.",
+	}, []string{"operation"})
+
+	// RecordsStale reports whether records are served from the last known listing.
+	RecordsStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "records_stale",
+		Help:      "Whether the last record listing was served from the last known records instead of the controller.",
+	}, []string{"tenant"})
+
+	// ReadinessState reports the readiness state of every tenant, 1 for the current state.
+	ReadinessState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "readiness_state",
+		Help:      "Readiness state of the tenant as reported by the last readiness probe, 1 for the current state of ready, degraded and not-ready.",
+	}, []string{"tenant", "state"})
+
+	// RecordsStaleAge reports the age of the stale records served.
+	RecordsStaleAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "records_stale_age_seconds",
+		Help:      "Age in seconds of the stale records served by the last record listing, 0 when fresh.",
+	}, []string{"tenant"})
+
+	// RollbackRecordsTotal counts the records deleted to roll back failed plans.
+	RollbackRecordsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollback_records_total",
+		Help:      "Number of records created by a failed plan and deleted again to roll it back, by result.",
+	}, []string{"result"})
+
+	// FilteredEndpointsTotal counts endpoints dropped by a filter, by the filter that dropped them.
+	FilteredEndpointsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "filtered_endpoints_total",
+		Help:      "Number of endpoints dropped by a filter, by reason.",
+	}, []string{"reason"})
+
+	// CircuitOpenUntil reports until when requests to the controller are held back by the circuit breaker.
+	CircuitOpenUntil = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_open_until_timestamp_seconds",
+		Help:      "Unix timestamp until which requests to the controller fail immediately after consecutive failures, 0 while the circuit is closed.",
+	}, []string{"tenant"})
+
+	// PlansCanceledTotal counts plans stopped because the request was canceled.
+	PlansCanceledTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "plans_canceled_total",
+		Help:      "Number of plans stopped between records because the request was canceled or timed out.",
+	})
+
+	// CanceledPlanChangesTotal counts the changes of canceled plans, by whether they were applied.
+	CanceledPlanChangesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "canceled_plan_changes_total",
+		Help:      "Number of changes of canceled plans, by result (applied or not_applied).",
+	}, []string{"result"})
+
+	// ChangesTotal counts the changes applied to the controller, by operation.
+	ChangesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "changes_total",
+		Help:      "Number of endpoints changed on the controller, by operation (create, update or delete).",
+	}, []string{"operation"})
+
+	// ChangesByTypeTotal counts the changes applied to the controller, by operation and record type.
+	ChangesByTypeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "changes_by_type_total",
+		Help:      "Number of endpoints changed on the controller, by operation (create, update or delete) and record type.",
+	}, []string{"operation", "record_type"})
+)
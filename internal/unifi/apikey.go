@@ -0,0 +1,99 @@
+package unifi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+// apiKeySource holds the API key used to authenticate against the UniFi controller.
+// When the key comes from a file, it is re-read so rotated secrets are picked up without a restart.
+type apiKeySource struct {
+	mu   sync.RWMutex
+	key  string
+	file string
+}
+
+// newAPIKeySource returns the API key source for the configuration, or nil when no API key is configured.
+// A key file is watched until ctx is canceled.
+func newAPIKeySource(ctx context.Context, config *Config) (*apiKeySource, error) {
+	if config.APIKeyFile == "" {
+		if config.APIKey == "" {
+			return nil, nil
+		}
+		return &apiKeySource{key: config.APIKey}, nil
+	}
+
+	s := &apiKeySource{file: config.APIKeyFile}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	go s.watch(ctx, config.APIKeyReloadInterval)
+	return s, nil
+}
+
+// Get returns the current API key.
+func (s *apiKeySource) Get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.key
+}
+
+// reload re-reads the API key file and reports whether the key changed.
+func (s *apiKeySource) reload() (bool, error) {
+	if s.file == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read api key file %s: %w", s.file, err)
+	}
+
+	key := string(bytes.TrimSpace(data))
+	if key == "" {
+		return false, fmt.Errorf("api key file %s is empty", s.file)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == s.key {
+		return false, nil
+	}
+	s.key = key
+	return true, nil
+}
+
+// watch periodically reloads the API key file until ctx is canceled.
+func (s *apiKeySource) watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := s.reload()
+		if err != nil {
+			log.Error("failed to reload api key", zap.Error(err))
+			continue
+		}
+		if changed {
+			log.Info("reloaded rotated api key", zap.String("file", s.file))
+		}
+	}
+}
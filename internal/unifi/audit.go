@@ -0,0 +1,82 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+// auditEntry is a single line of the audit log.
+type auditEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	Site      string    `json:"site"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	ID        string    `json:"id,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLogger appends a JSON line for every mutation sent to the controller.
+// A nil auditLogger discards all entries.
+type auditLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// newAuditLogger opens the audit log destination, "stdout" and "stderr" select the process streams.
+func newAuditLogger(path string) (*auditLogger, error) {
+	var w io.Writer
+	switch path {
+	case "":
+		return nil, nil
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+		}
+		w = f
+	}
+
+	return &auditLogger{enc: json.NewEncoder(w)}, nil
+}
+
+// record appends the outcome of a mutation of the record.
+func (a *auditLogger) record(operation, site string, record DNSRecord, err error) {
+	if a == nil {
+		return
+	}
+
+	entry := auditEntry{
+		Timestamp: time.Now().UTC(),
+		Operation: operation,
+		Site:      site,
+		Name:      record.Key,
+		Type:      record.RecordType,
+		Value:     record.Value,
+		ID:        record.ID,
+		Result:    "success",
+	}
+	if err != nil {
+		entry.Result = "error"
+		entry.Error = err.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(entry); err != nil {
+		log.Error("failed to write audit log entry", zap.Error(err))
+	}
+}
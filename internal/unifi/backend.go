@@ -0,0 +1,117 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// RecordsBackendStaticDNS manages records through the static-dns API.
+	RecordsBackendStaticDNS = "static-dns"
+	// RecordsBackendDNSRecords manages records through the policy engine DNS records API of Network 9.x.
+	RecordsBackendDNSRecords = "dns-records"
+	// RecordsBackendAuto probes the controller for the DNS records API and falls back to static-dns.
+	RecordsBackendAuto = "auto"
+)
+
+// validateRecordsBackend checks that the configured records backend is known.
+func validateRecordsBackend(backend string) error {
+	switch backend {
+	case RecordsBackendStaticDNS, RecordsBackendDNSRecords, RecordsBackendAuto:
+		return nil
+	default:
+		return fmt.Errorf("unknown records backend: %s", backend)
+	}
+}
+
+// newClientURLs returns the paths for the controller layout and records backend.
+// The auto backend starts out on static-dns until detection has run.
+func newClientURLs(external bool, backend string) *ClientURLs {
+	urls := &ClientURLs{
+		Login:   unifiLoginPath,
+		Self:    unifiSelfPath,
+		Network: unifiNetworkPath,
+		Records: unifiStaticDNSRecords,
+	}
+	if backend == RecordsBackendDNSRecords {
+		urls.Records = unifiDNSRecords
+	}
+
+	if external {
+		urls.Login = unifiLoginPathExternal
+		urls.Self = unifiSelfPathExternal
+		urls.Network = unifiNetworkPathExternal
+	}
+	return urls
+}
+
+// detectRecordsBackend probes the DNS records API and returns the backend to use.
+func (c *httpClient) detectRecordsBackend() string {
+	probe := *c.layout.Load()
+	probe.urls = newClientURLs(probe.external, RecordsBackendDNSRecords)
+
+	req, err := http.NewRequest(http.MethodGet, probe.recordsURL(c.Config.Host, ""), nil)
+	if err != nil {
+		return RecordsBackendStaticDNS
+	}
+	c.setHeaders(req)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		log.Debug("dns records backend probe failed", zap.Error(err))
+		return RecordsBackendStaticDNS
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Debug("dns records backend not available", zap.Int("status", resp.StatusCode))
+		return RecordsBackendStaticDNS
+	}
+
+	return RecordsBackendDNSRecords
+}
+
+// detectExternalController locates the network application to tell UniFi OS consoles from self-hosted
+// controllers: consoles serve it under /proxy/network, self-hosted controllers at the root. Its self
+// endpoint answers 401 without a session, while the other layout answers 404 or redirects to the UI.
+func (c *httpClient) detectExternalController() (bool, error) {
+	client := &http.Client{
+		Transport: c.Client.Transport,
+		Timeout:   c.Client.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, layout := range []struct {
+		external bool
+		path     string
+	}{
+		{external: false, path: unifiNetworkPath + unifiSelfPathExternal},
+		{external: true, path: unifiNetworkPathExternal + unifiSelfPathExternal},
+	} {
+		req, err := http.NewRequest(http.MethodGet, c.Config.Host+layout.path, nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("User-Agent", userAgent(c.Config))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusOK, resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+			return layout.external, nil
+		case resp.StatusCode >= http.StatusInternalServerError:
+			return false, fmt.Errorf("unexpected status probing %s: %s", req.URL, resp.Status)
+		}
+		log.Debug("network application not found", zap.String("path", layout.path), zap.Int("status", resp.StatusCode))
+	}
+	return false, fmt.Errorf("no unifi network application found at %s", c.Config.Host)
+}
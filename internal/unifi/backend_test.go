@@ -0,0 +1,57 @@
+package unifi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+)
+
+func TestDetectExternalController(t *testing.T) {
+	tests := []struct {
+		name     string
+		external bool
+		faults   []unifitest.Fault
+		wantErr  bool
+	}{
+		{name: "unifi os"},
+		{name: "self-hosted", external: true},
+		{
+			// Self-hosted controllers may send unknown paths to their UI instead of answering 404.
+			name:     "self-hosted redirecting unknown paths",
+			external: true,
+			faults:   []unifitest.Fault{{Path: "/proxy/network/api/self", Status: http.StatusFound, Header: http.Header{"Location": {"/manage"}}}},
+		},
+		{
+			name:    "no network application",
+			faults:  []unifitest.Fault{{Path: "/api/self", Status: http.StatusNotFound}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{External: tt.external})
+			for _, f := range tt.faults {
+				c.Inject(f)
+			}
+			config := newTestConfig(t, c, tt.external, nil)
+			config.ExternalController = nil
+
+			client, err := newUnifiClient(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			external, err := client.detectExternalController()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectExternalController() error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && external != tt.external {
+				t.Errorf("detectExternalController() = %t, want %t", external, tt.external)
+			}
+			if !tt.wantErr && client.Ready() != nil {
+				t.Errorf("client not connected: %v", client.Ready())
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package unifi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestIndexLookupIgnoresCase(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     DNSRecord
+		lookupName string
+		target     string
+	}{
+		{name: "lowercase lookup", stored: DNSRecord{ID: "1", Key: "Web.Example.COM", RecordType: "A", Value: "10.0.0.1"}, lookupName: "web.example.com", target: "10.0.0.1"},
+		{name: "uppercase lookup", stored: DNSRecord{ID: "1", Key: "web.example.com", RecordType: "A", Value: "10.0.0.1"}, lookupName: "WEB.example.com", target: "10.0.0.1"},
+		{name: "trailing dot", stored: DNSRecord{ID: "1", Key: "Web.Example.com.", RecordType: "A", Value: "10.0.0.1"}, lookupName: "web.example.com", target: "10.0.0.1"},
+		{name: "cname target", stored: DNSRecord{ID: "1", Key: "www.example.com", RecordType: "CNAME", Value: "Web.Example.com"}, lookupName: "WWW.example.com", target: "web.example.com."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var index recordIndex
+			index.rebuild([]DNSRecord{tt.stored})
+
+			records, ok, _ := index.lookup(tt.lookupName, tt.stored.RecordType, []string{tt.target})
+			if !ok || len(records) != 1 || records[0].ID != tt.stored.ID {
+				t.Errorf("lookup(%q, %q) = %v, %t, want record %s", tt.lookupName, tt.target, records, ok, tt.stored.ID)
+			}
+		})
+	}
+}
+
+func TestDeleteEndpointIgnoresCase(t *testing.T) {
+	tests := []struct {
+		stored  string
+		deleted string
+	}{
+		{stored: "Web.Example.com", deleted: "web.example.com"},
+		{stored: "web.example.com", deleted: "Web.Example.COM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stored+" as "+tt.deleted, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default", unifitest.Record{Enabled: true, Key: tt.stored, RecordType: "A", Value: "10.0.0.1"})
+			p := newTestProvider(t, c, nil)
+
+			// The listing fills the index the delete resolves its record from.
+			if _, err := p.client.GetEndpoints(); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.client.DeleteEndpoint(endpoint.NewEndpoint(tt.deleted, "A", "10.0.0.1")); err != nil {
+				t.Fatal(err)
+			}
+			if records := c.Records("default"); len(records) != 0 {
+				t.Errorf("records left after delete: %+v", records)
+			}
+		})
+	}
+}
+
+func TestValidateCNAMEConflictsIgnoresCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []unifitest.Record
+		changes  plan.Changes
+		conflict bool
+	}{
+		{
+			name:     "cname next to existing record",
+			existing: []unifitest.Record{{Key: "Foo.lan", RecordType: "A", Value: "10.0.0.1"}},
+			changes:  plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.lan", "CNAME", "bar.lan")}},
+			conflict: true,
+		},
+		{
+			name:     "record next to existing cname",
+			existing: []unifitest.Record{{Key: "foo.lan", RecordType: "CNAME", Value: "bar.lan"}},
+			changes:  plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("FOO.lan", "A", "10.0.0.1")}},
+			conflict: true,
+		},
+		{
+			name: "conflict within the plan",
+			changes: plan.Changes{Create: []*endpoint.Endpoint{
+				endpoint.NewEndpoint("Foo.lan", "A", "10.0.0.1"),
+				endpoint.NewEndpoint("foo.lan", "CNAME", "bar.lan"),
+			}},
+			conflict: true,
+		},
+		{
+			name:     "existing record deleted by the plan",
+			existing: []unifitest.Record{{Key: "Foo.lan", RecordType: "A", Value: "10.0.0.1"}},
+			changes: plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.lan", "CNAME", "bar.lan")},
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("foo.lan", "A", "10.0.0.1")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default", tt.existing...)
+			p := newTestProvider(t, c, map[string]string{"UNIFI_CNAME_CONFLICT_POLICY": CNAMEConflictPolicyReject})
+
+			err := p.validateCNAMEConflicts(&tt.changes)
+			var rejected *PlanRejectedError
+			if tt.conflict && !errors.As(err, &rejected) {
+				t.Errorf("conflict not rejected, got %v", err)
+			}
+			if !tt.conflict && err != nil {
+				t.Errorf("plan rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestOwnershipIgnoresMarkerCase(t *testing.T) {
+	const instanceID = "test-instance"
+	owner := ownershipHeritage + ",owner=" + instanceID
+
+	tests := []struct {
+		name   string
+		marker string
+		record string
+	}{
+		{name: "same case", marker: "_unifi-webhook.web.lan", record: "web.lan"},
+		{name: "uppercase marker name", marker: "_unifi-webhook.Web.LAN", record: "web.lan"},
+		{name: "uppercase prefix", marker: "_UNIFI-WEBHOOK.web.lan", record: "Web.lan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			p := newTestProvider(t, c, map[string]string{"UNIFI_OWNERSHIP": "true", "UNIFI_INSTANCE_ID": instanceID})
+
+			records := []DNSRecord{
+				{Key: tt.marker, RecordType: "TXT", Value: owner},
+				{Key: tt.record, RecordType: "A", Value: "10.0.0.1"},
+			}
+			owned := p.ownedNames(records)
+			if !owned["web.lan"] {
+				t.Fatalf("marker %s not accepted, owned names: %v", tt.marker, owned)
+			}
+
+			changes := plan.Changes{
+				Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("WEB.lan", "AAAA", "fd00::1")},
+				UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("web.LAN", "A", "10.0.0.1")},
+				UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("web.LAN", "A", "10.0.0.2")},
+				Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("Web.Lan", "A", "10.0.0.1")},
+			}
+			p.filterUnowned(&changes, records, owned)
+			for action, kept := range map[string][]*endpoint.Endpoint{"create": changes.Create, "update old": changes.UpdateOld, "update new": changes.UpdateNew, "delete": changes.Delete} {
+				if len(kept) != 1 {
+					t.Errorf("%s of an owned name dropped", action)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// UnavailableError is returned while requests to the controller are held back, because the
+// circuit breaker is open or logins are backing off after rejected attempts.
+type UnavailableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusCode reports the controller as temporarily unavailable.
+func (e *UnavailableError) HTTPStatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// RetryDelay returns the time until requests are sent to the controller again.
+func (e *UnavailableError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// circuit stops sending requests to a controller failing consecutively. Once open, requests fail
+// immediately for the cool-down, after which the next request probes the controller: a success
+// closes the circuit, a failure opens it again.
+type circuit struct {
+	sync.Mutex
+	tenant    string
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+}
+
+// check returns an UnavailableError while the circuit is open.
+func (c *circuit) check() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if wait := time.Until(c.openUntil); wait > 0 {
+		return &UnavailableError{
+			Err:        fmt.Errorf("unifi controller unavailable after %d consecutive failures, retry after %s", c.failures, wait.Round(time.Second)),
+			RetryAfter: wait,
+		}
+	}
+	return nil
+}
+
+// record counts the outcome of a request, opening the circuit once the threshold of consecutive
+// failures is reached. A threshold of 0 disables the circuit breaker.
+func (c *circuit) record(failed bool) {
+	if c.threshold <= 0 {
+		return
+	}
+
+	c.Lock()
+	if !failed {
+		if c.failures >= c.threshold {
+			log.Info("unifi controller recovered, closing the circuit")
+			metrics.CircuitOpenUntil.WithLabelValues(c.tenant).Set(0)
+		}
+		c.failures = 0
+		c.openUntil = time.Time{}
+		c.Unlock()
+		return
+	}
+
+	c.failures++
+	failures := c.failures
+	if failures >= c.threshold {
+		c.openUntil = time.Now().Add(c.cooldown)
+		metrics.CircuitOpenUntil.WithLabelValues(c.tenant).Set(float64(c.openUntil.Unix()))
+		log.Warn("unifi controller failing, opening the circuit", zap.Int("failures", failures), zap.Duration("cooldown", c.cooldown))
+	}
+	c.Unlock()
+
+	// Failed probes after the cool-down open the circuit again, only the transition from closed is reported.
+	if failures == c.threshold {
+		RecordEvent(EventCircuitOpened, fmt.Sprintf("Requests to the unifi controller held back for %s after %d consecutive failures", c.cooldown, failures))
+	}
+}
+
+// until returns the time until which the circuit is open, zero while closed.
+func (c *circuit) until() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	if time.Now().Before(c.openUntil) {
+		return c.openUntil
+	}
+	return time.Time{}
+}
@@ -0,0 +1,48 @@
+package unifi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitReportsOpening(t *testing.T) {
+	var events []string
+	recordEvent := RecordEvent
+	RecordEvent = func(reason, message string) { events = append(events, reason) }
+	t.Cleanup(func() { RecordEvent = recordEvent })
+
+	c := &circuit{tenant: "circuit-test", threshold: 2, cooldown: time.Minute}
+	steps := []struct {
+		failed bool
+		events int
+		open   bool
+	}{
+		{failed: true, events: 0},
+		{failed: true, events: 1, open: true},
+		// A failed probe after the cool-down opens the circuit again without another event.
+		{failed: true, events: 1, open: true},
+		{failed: false, events: 1},
+		{failed: true, events: 1},
+		{failed: true, events: 2, open: true},
+	}
+	for i, step := range steps {
+		c.record(step.failed)
+		if len(events) != step.events {
+			t.Errorf("step %d: %d events, want %d", i, len(events), step.events)
+		}
+		if open := c.check() != nil; open != step.open {
+			t.Errorf("step %d: circuit open %t, want %t", i, open, step.open)
+		}
+		if open := testutil.ToFloat64(metrics.CircuitOpenUntil.WithLabelValues("circuit-test")) > 0; open != step.open {
+			t.Errorf("step %d: circuit gauge open %t, want %t", i, open, step.open)
+		}
+	}
+	for _, reason := range events {
+		if reason != EventCircuitOpened {
+			t.Errorf("event reason %s, want %s", reason, EventCircuitOpened)
+		}
+	}
+}
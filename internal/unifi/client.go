@@ -2,22 +2,51 @@ package unifi
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
-
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/buildinfo"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/jsonstream"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
 	"golang.org/x/net/publicsuffix"
 	"sigs.k8s.io/external-dns/endpoint"
 
 	"go.uber.org/zap"
 )
 
+// UnifiAPI is the set of record operations the provider performs against the controller.
+type UnifiAPI interface {
+	Ready() error
+	Close() error
+	GetEndpoints() ([]DNSRecord, error)
+	CreateEndpoint(endpoint *endpoint.Endpoint) ([]*DNSRecord, error)
+	UpdateEndpoint(ctx context.Context, old, new *endpoint.Endpoint) error
+	DeleteEndpoint(endpoint *endpoint.Endpoint) error
+}
+
+var _ recordsClient = (*httpClient)(nil)
+
+// ClientURLs holds the paths of the controller layout and records backend in use.
 type ClientURLs struct {
-	Login   string
+	// Login is the path of the login endpoint.
+	Login string
+	// Self is the path of the current user endpoint.
+	Self string
+	// Network is the path prefix of the Network application.
+	Network string
+	// Records is the records collection of a site.
 	Records string
 }
 
@@ -25,58 +54,208 @@ type ClientURLs struct {
 type httpClient struct {
 	*Config
 	*http.Client
-	csrf       string
-	ClientURLs *ClientURLs
+	session    session
+	apiKey     *apiKeySource
+	totpKey    []byte
+	layout     atomic.Pointer[controllerLayout]
+	connection connection
+	protected  protectedRecords
+	audit      *auditLogger
+	rateLimit  rateLimit
+	circuit    circuit
+
+	recordsCache recordsCache
+	index        recordIndex
+
+	// defaultTTL is the TTL the controller assigns to records created without one, zero while unknown.
+	defaultTTL atomic.Int64
+
+	// ctx is canceled by Close to stop the background loops of the client.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// recordsCache holds the last static-dns listing together with its validators,
+// allowing conditional requests to skip downloading and decoding unchanged records.
+type recordsCache struct {
+	sync.Mutex
+	etag         string
+	lastModified string
+	records      []DNSRecord
+}
+
+// userAgent returns the User-Agent sent to the controller.
+func userAgent(config *Config) string {
+	if config.UserAgent != "" {
+		return config.UserAgent
+	}
+	return "external-dns-unifi-webhook/" + buildinfo.Version
 }
 
 const (
-	unifiLoginPath          = "%s/api/auth/login"
-	unifiLoginPathExternal  = "%s/api/login"
-	unifiRecordPath         = "%s/proxy/network/v2/api/site/%s/static-dns/%s"
-	unifiRecordPathExternal = "%s/v2/api/site/%s/static-dns/%s"
+	unifiLoginPath           = "/api/auth/login"
+	unifiLoginPathExternal   = "/api/login"
+	unifiSelfPath            = "/api/users/self"
+	unifiSelfPathExternal    = "/api/self"
+	unifiNetworkPath         = "/proxy/network"
+	unifiNetworkPathExternal = ""
+	unifiSitePath            = "/v2/api/site"
+	unifiStaticDNSRecords    = "static-dns"
+	unifiDNSRecords          = "dns-records"
 )
 
 // newUnifiClient creates a new DNS provider client and logs in to store cookies.
+// An unreachable controller does not fail the client, the connection is retried in the background instead.
 func newUnifiClient(config *Config) (*httpClient, error) {
+	if config.CloudConsoleID != "" {
+		if err := configureCloud(config); err != nil {
+			return nil, err
+		}
+	} else {
+		host, err := normalizeHost(config.Host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UNIFI_HOST %q: %w", config.Host, err)
+		}
+		config.Host = host
+	}
+
+	if err := validateRecordsBackend(config.RecordsBackend); err != nil {
+		return nil, err
+	}
+
+	protected, err := newProtectedRecords(config.ProtectedRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := newAuditLogger(config.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	var totpKey []byte
+	if config.TOTPSecret != "" {
+		if totpKey, err = decodeTOTPSecret(config.TOTPSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	apiKey, err := newAPIKeySource(ctx, config)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if apiKey == nil && (config.User == "" || config.Password == "") {
+		cancel()
+		return nil, fmt.Errorf("either an api key or a username and password must be configured")
+	}
+
 	// Create the HTTP client
 	client := &httpClient{
 		Config: config,
 		Client: &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: config.SkipTLSVerify},
-			},
-			Jar: jar,
-		},
-		ClientURLs: &ClientURLs{
-			Login:   unifiLoginPath,
-			Records: unifiRecordPath,
+			Transport: newTransport(config, tlsConfig),
+			Jar:       jar,
+			Timeout:   config.ClientTimeout,
 		},
+		apiKey:    apiKey,
+		totpKey:   totpKey,
+		protected: protected,
+		audit:     audit,
+		session:   session{tenant: config.Tenant},
+		circuit:   circuit{tenant: config.Tenant, threshold: config.CircuitBreakerThreshold, cooldown: config.CircuitBreakerCooldown},
+		index:     recordIndex{tenant: config.Tenant},
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
+	client.defaultTTL.Store(int64(config.DefaultTTL))
+	client.publish(newControllerLayout(config))
 
-	if config.ExternalController {
-		client.ClientURLs.Login = unifiLoginPathExternal
-		client.ClientURLs.Records = unifiRecordPathExternal
-	}
+	client.initialConnect()
+	go client.keepalive()
 
-	if err := client.login(); err != nil {
+	return client, nil
+}
+
+// NewClient returns a client of the records of the configured controller.
+func NewClient(config *Config) (UnifiAPI, error) {
+	client, err := newUnifiClient(config)
+	if err != nil {
 		return nil, err
 	}
-
 	return client, nil
 }
 
+// Close stops the background loops of the client and closes its idle connections.
+func (c *httpClient) Close() error {
+	c.cancel()
+	c.Client.CloseIdleConnections()
+	return nil
+}
+
+// expireIndex marks the record index stale, so records resolved from it are checked against the controller again.
+func (c *httpClient) expireIndex() {
+	c.index.expire()
+}
+
+// newTransport returns the transport used for the controller, with connection pooling
+// tuned so large apply batches reuse connections instead of repeating TLS handshakes.
+func newTransport(config *Config, tlsConfig *tls.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: config.TCPKeepAlive,
+	}
+
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        config.MaxIdleConns,
+		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		IdleConnTimeout:     config.IdleConnTimeout,
+		DisableKeepAlives:   config.DisableKeepAlives,
+	}
+}
+
 // login performs a login request to the UniFi controller.
+// Rejected logins back off exponentially so repeated attempts cannot lock the account.
 func (c *httpClient) login() error {
-	jsonBody, err := json.Marshal(Login{
+	if err := c.session.loginAllowed(); err != nil {
+		return err
+	}
+
+	err := c.doLogin()
+	if IsAuthError(err) {
+		retryIn := c.session.loginFailed()
+		log.Error("login rejected, backing off", zap.Error(err), zap.Duration("retry_in", retryIn))
+		RecordEvent(EventLoginFailed, fmt.Sprintf("Login to %s rejected, logins disabled for %s: %v", c.Config.Host, retryIn, err))
+		return err
+	}
+	return err
+}
+
+func (c *httpClient) doLogin() error {
+	login := Login{
 		Username: c.Config.User,
 		Password: c.Config.Password,
 		Remember: true,
-	})
+	}
+	if c.totpKey != nil {
+		login.Token = totpCode(c.totpKey, time.Now())
+	}
+
+	jsonBody, err := json.Marshal(login)
 	if err != nil {
 		return err
 	}
@@ -84,7 +263,7 @@ func (c *httpClient) login() error {
 	// Perform the login request
 	resp, err := c.doRequest(
 		http.MethodPost,
-		FormatUrl(c.ClientURLs.Login, c.Config.Host),
+		c.loginURL(),
 		bytes.NewBuffer(jsonBody),
 	)
 	if err != nil {
@@ -97,13 +276,11 @@ func (c *httpClient) login() error {
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		log.Error("login failed", zap.String("status", resp.Status), zap.String("response", string(respBody)))
-		return fmt.Errorf("login failed: %s", resp.Status)
+		return &AuthError{Err: fmt.Errorf("login failed: %s", resp.Status)}
 	}
 
 	// Retrieve CSRF token from the response headers
-	if csrf := resp.Header.Get("x-csrf-token"); csrf != "" {
-		c.csrf = resp.Header.Get("x-csrf-token")
-	}
+	c.session.loggedIn(resp.Header.Get("x-csrf-token"))
 	return nil
 }
 
@@ -113,75 +290,202 @@ func (c *httpClient) doRequest(method, path string, body io.Reader) (*http.Respo
 		return nil, err
 	}
 
-	c.setHeaders(req)
+	return c.do(req)
+}
 
-	resp, err := c.Client.Do(req)
+// do sends the request bounded by the configured request timeout, which covers retries after
+// re-authentication and lasts until the response body is closed.
+func (c *httpClient) do(req *http.Request) (*http.Response, error) {
+	if c.Config.RequestTimeout <= 0 {
+		return c.send(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), c.Config.RequestTimeout)
+	resp, err := c.send(req.WithContext(ctx))
 	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the request context once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (c *httpClient) send(req *http.Request) (*http.Response, error) {
+	method, path := req.Method, req.URL.String()
+	if err := c.rateLimit.check(); err != nil {
+		return nil, err
+	}
+	if err := c.circuit.check(); err != nil {
 		return nil, err
 	}
+	c.setHeaders(req)
 
-	if csrf := resp.Header.Get("X-CSRF-Token"); csrf != "" {
-		c.csrf = csrf
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return nil, &NetworkError{Err: err}
+	}
+
+	c.session.setCSRF(resp.Header.Get("X-CSRF-Token"))
+
+	// If the status code is 401 with an api key, pick up a rotated key and retry the request
+	if resp.StatusCode == http.StatusUnauthorized && c.apiKey != nil {
+		changed, err := c.apiKey.reload()
+		if err != nil {
+			log.Error("api key reload failed", zap.Error(err))
+		}
+		if changed {
+			resp.Body.Close()
+			log.Debug("retrying request with rotated api key")
+			if err := rewindBody(req); err != nil {
+				return nil, err
+			}
+			c.setHeaders(req)
+
+			resp, err = c.roundTrip(req)
+			if err != nil {
+				log.Error("Retry request failed", zap.Error(err))
+				return nil, &NetworkError{Err: err}
+			}
+		}
 	}
 
-	// If the status code is 401, re-login and retry the request
-	if resp.StatusCode == http.StatusUnauthorized {
+	// If the status code is 401, re-login and retry the request, unless the login itself was rejected
+	if resp.StatusCode == http.StatusUnauthorized && c.apiKey == nil && path != c.loginURL() {
 		log.Debug("received 401 unauthorized, attempting to re-login")
 		if err := c.login(); err != nil {
 			log.Error("re-login failed", zap.Error(err))
 			return nil, err
 		}
+		if err := rewindBody(req); err != nil {
+			return nil, err
+		}
 		// Update the headers with new CSRF token
 		c.setHeaders(req)
 
 		// Retry the request
 		log.Debug("retrying request after re-login")
 
-		resp, err = c.Client.Do(req)
+		resp, err = c.roundTrip(req)
 		if err != nil {
 			log.Error("Retry request failed", zap.Error(err))
-			return nil, err
+			return nil, &NetworkError{Err: err}
 		}
 	}
 
+	// Back off for as long as the controller asks instead of retrying on the next cycle
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		c.rateLimit.backoff(retryAfter)
+		metrics.RateLimitedTotal.Inc()
+		log.Warn("rate limited by the unifi controller", zap.String("method", method), zap.String("path", path), zap.Duration("retry_after", retryAfter))
+		return nil, &RateLimitError{RetryAfter: retryAfter}
+	}
+
 	// It is unknown at this time if the UniFi API returns anything other than 200 for these types of requests.
-	if resp.StatusCode != http.StatusOK {
+	// 304 is only returned for conditional requests and handled by the caller.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
 		body, bodyErr := io.ReadAll(io.LimitReader(resp.Body, 512))
 		if bodyErr != nil {
-			return nil, bodyErr
+			return nil, &NetworkError{Err: bodyErr}
 		}
 
-		var apiError UnifiErrorResponse
-		if err := json.Unmarshal(body, &apiError); err != nil {
-			return nil, fmt.Errorf("failed to decode json: %w", err)
+		// Fall back to the raw body when the controller does not answer with its JSON error format.
+		message := string(body)
+		var unifiError UnifiErrorResponse
+		if err := json.Unmarshal(body, &unifiError); err == nil && unifiError.Message != "" {
+			message = unifiError.Message
 		}
 
-		return nil, fmt.Errorf("%s request to %s returned %d: %s", method, path, resp.StatusCode, apiError.Message)
+		apiErr := &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: message}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, &AuthError{Err: apiErr}
+		}
+		return nil, apiErr
 	}
 
 	return resp, nil
 }
 
+// roundTrip sends a single request to the controller and observes its duration.
+func (c *httpClient) roundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.Client.Do(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	c.circuit.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	metrics.UnifiAPIDuration.WithLabelValues(req.Method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
 // GetEndpoints retrieves the list of DNS records from the UniFi controller.
 func (c *httpClient) GetEndpoints() ([]DNSRecord, error) {
-	resp, err := c.doRequest(
+	if err := c.Ready(); err != nil {
+		return nil, err
+	}
+
+	// Neither records API accepts query filters, unknown parameters are ignored and every record of
+	// the site is returned. The provider applies the domain filter to the listing instead, and
+	// conditional requests avoid downloading the listing again while it is unchanged.
+	req, err := http.NewRequest(
 		http.MethodGet,
-		FormatUrl(c.ClientURLs.Records, c.Config.Host, c.Config.Site),
+		c.recordsURL(""),
 		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	// The validators are copied together with the records they describe, so concurrent listings
+	// do not wait on each other's round trip to the controller.
+	c.recordsCache.Lock()
+	etag, lastModified, cached := c.recordsCache.etag, c.recordsCache.lastModified, c.recordsCache.records
+	c.recordsCache.Unlock()
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		log.Debug("records not modified, using cached records", zap.Int("count", len(cached)))
+		c.index.rebuild(cached)
+		return slices.Clone(cached), nil
+	}
+
 	var records []DNSRecord
-	if err = json.NewDecoder(resp.Body).Decode(&records); err != nil {
+	err = jsonstream.DecodeArray(json.NewDecoder(resp.Body), func(r DNSRecord) { records = append(records, r) })
+	if err != nil {
 		log.Error("Failed to decode response", zap.Error(err))
-		return nil, err
+		return nil, &DataError{Err: err}
 	}
 
-	// Loop through records to modify SRV type
+	// Loop through records to strip fully qualified targets and modify SRV type
 	for i, record := range records {
+		records[i].Value = trimTargetDot(record.RecordType, record.Value)
 		if record.RecordType != "SRV" {
 			continue
 		}
@@ -191,38 +495,104 @@ func (c *httpClient) GetEndpoints() ([]DNSRecord, error) {
 			*record.Priority,
 			*record.Weight,
 			*record.Port,
-			record.Value,
+			records[i].Value,
 		)
 		records[i].Priority = nil
 		records[i].Weight = nil
 		records[i].Port = nil
 	}
 
+	c.recordsCache.Lock()
+	c.recordsCache.etag = resp.Header.Get("ETag")
+	c.recordsCache.lastModified = resp.Header.Get("Last-Modified")
+	c.recordsCache.records = nil
+	if c.recordsCache.etag != "" || c.recordsCache.lastModified != "" {
+		c.recordsCache.records = slices.Clone(records)
+	}
+	c.recordsCache.Unlock()
+
+	c.index.rebuild(records)
+
 	log.Debug("retrieved records", zap.Int("count", len(records)))
 	return records, nil
 }
 
-// CreateEndpoint creates a new DNS record in the UniFi controller.
-// Future Kash: We don't support multiple targets per dns name and need to effectively create x records.
-func (c *httpClient) CreateEndpoint(endpoint *endpoint.Endpoint) (*DNSRecord, error) {
-	record := DNSRecord{
-		Enabled:    true,
-		Key:        endpoint.DNSName,
-		RecordType: endpoint.RecordType,
-		TTL:        endpoint.RecordTTL,
-		Value:      endpoint.Targets[0],
+// RawRecords returns the record listing exactly as the UniFi controller sent it.
+func (c *httpClient) RawRecords(ctx context.Context) ([]byte, error) {
+	if err := c.Ready(); err != nil {
+		return nil, err
 	}
 
-	if endpoint.RecordType == "SRV" {
-		record.Priority = new(int)
-		record.Weight = new(int)
-		record.Port = new(int)
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		c.recordsURL(""),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		if _, err := fmt.Sscanf(endpoint.Targets[0], "%d %d %d %s", record.Priority, record.Weight, record.Port, &record.Value); err != nil {
-			return nil, err
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// CreateEndpoint creates one DNS record per endpoint target in the UniFi controller.
+func (c *httpClient) CreateEndpoint(endpoint *endpoint.Endpoint) ([]*DNSRecord, error) {
+	if err := c.Ready(); err != nil {
+		return nil, err
+	}
+
+	if isWildcard(endpoint.DNSName) {
+		skipWildcard(endpoint)
+		return nil, nil
+	}
+
+	enabled, err := endpointEnabled(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := endpointTTL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ttl = c.writeTTL(endpoint.RecordType, ttl)
+
+	var created []*DNSRecord
+	for _, target := range endpoint.Targets {
+		record := DNSRecord{
+			Enabled:    enabled,
+			Key:        endpoint.DNSName,
+			RecordType: endpoint.RecordType,
+			TTL:        ttl,
+			Value:      trimTargetDot(endpoint.RecordType, target),
+		}
+
+		if endpoint.RecordType == "SRV" {
+			if err := ParseSRVTarget(target, &record); err != nil {
+				return created, err
+			}
+		}
+
+		createdRecord, err := c.createRecord(record)
+		if err != nil {
+			c.audit.record("create", c.site(), record, err)
+			return created, err
 		}
+		c.audit.record("create", c.site(), *createdRecord, nil)
+		created = append(created, createdRecord)
 	}
 
+	return created, nil
+}
+
+// createRecord creates a single DNS record in the UniFi controller.
+func (c *httpClient) createRecord(record DNSRecord) (*DNSRecord, error) {
 	jsonBody, err := json.Marshal(record)
 	if err != nil {
 		return nil, err
@@ -230,7 +600,7 @@ func (c *httpClient) CreateEndpoint(endpoint *endpoint.Endpoint) (*DNSRecord, er
 
 	resp, err := c.doRequest(
 		http.MethodPost,
-		FormatUrl(c.ClientURLs.Records, c.Config.Host, c.Config.Site),
+		c.recordsURL(""),
 		bytes.NewReader(jsonBody),
 	)
 	if err != nil {
@@ -240,54 +610,263 @@ func (c *httpClient) CreateEndpoint(endpoint *endpoint.Endpoint) (*DNSRecord, er
 
 	var createdRecord DNSRecord
 	if err = json.NewDecoder(resp.Body).Decode(&createdRecord); err != nil {
-		return nil, err
+		return nil, &DataError{Err: err}
 	}
+	c.index.add(createdRecord)
+	c.learnDefaultTTL(record, createdRecord)
 
 	return &createdRecord, nil
 }
 
-// DeleteEndpoint deletes a DNS record from the UniFi controller.
+// DeleteEndpoint deletes the DNS records matching the endpoint's targets from the UniFi controller.
 func (c *httpClient) DeleteEndpoint(endpoint *endpoint.Endpoint) error {
-	lookup, err := c.lookupIdentifier(endpoint.DNSName, endpoint.RecordType)
+	if c.protected.Match(endpoint.DNSName) {
+		return fmt.Errorf("refusing to delete protected record: %s", endpoint.DNSName)
+	}
+
+	records, fresh, err := c.lookupIdentifiers(endpoint.DNSName, endpoint.RecordType, endpoint.Targets)
 	if err != nil {
 		return err
 	}
 
-	deleteURL := FormatUrl(c.ClientURLs.Records, c.Config.Host, c.Config.Site, lookup.ID)
+	// Records resolved from a listing older than the plan are checked against the controller before
+	// deleting them, the records still matching are deleted and the conflicts are reported afterwards.
+	var conflicts error
+	if !fresh {
+		records, err = c.revalidate("delete", records)
+		if err != nil && !IsConflictError(err) {
+			return err
+		}
+		conflicts = err
+	}
+
+	for _, record := range records {
+		if err := c.deleteRecord(record); err != nil {
+			return err
+		}
+	}
+
+	return conflicts
+}
+
+// deleteRecord deletes a single DNS record from the UniFi controller.
+// The records APIs offer no batch delete, so every record takes its own request.
+func (c *httpClient) deleteRecord(record DNSRecord) error {
+	deleteURL := c.recordsURL(record.ID)
 
-	_, err = c.doRequest(
+	resp, err := c.doRequest(
 		http.MethodDelete,
 		deleteURL,
 		nil,
 	)
+	c.audit.record("delete", c.site(), record, err)
+	// A failed delete may come from a stale index entry, the next listing rebuilds it.
+	c.index.remove(record)
+	if isNotFound(err) {
+		log.Debug("record already deleted", zap.String("id", record.ID), zap.String("name", record.Key), zap.String("type", record.RecordType))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// UpdateEndpoint updates the records of the old endpoint in place to match the new one.
+// Kept targets keep their record, and records are only created or deleted when the number of targets changes.
+func (c *httpClient) UpdateEndpoint(ctx context.Context, old, new *endpoint.Endpoint) error {
+	if err := c.Ready(); err != nil {
+		return err
+	}
+	if c.protected.Match(old.DNSName) {
+		return fmt.Errorf("refusing to update protected record: %s", old.DNSName)
+	}
+
+	records, fresh, err := c.lookupIdentifiers(old.DNSName, old.RecordType, old.Targets)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		if records, err = c.revalidate("update", records); err != nil {
+			return err
+		}
+	}
+
+	enabled, err := endpointEnabled(new)
+	if err != nil {
+		return err
+	}
+	ttl, err := endpointTTL(new)
+	if err != nil {
+		return err
+	}
+	ttl = c.writeTTL(new.RecordType, ttl)
+
+	// Match the new targets to the records already holding them, the rest are reassigned or created.
+	var pairs []DNSRecord
+	var added []string
+	unused := slices.Clone(records)
+	for _, target := range new.Targets {
+		i := slices.IndexFunc(unused, func(r DNSRecord) bool {
+			return normalizeTarget(new.RecordType, r.Value) == normalizeTarget(new.RecordType, target)
+		})
+		if i < 0 {
+			added = append(added, target)
+			continue
+		}
+		r := unused[i]
+		r.Value = trimTargetDot(new.RecordType, target)
+		pairs = append(pairs, r)
+		unused = slices.Delete(unused, i, i+1)
+	}
+	for len(added) > 0 && len(unused) > 0 {
+		r := unused[0]
+		r.Value = trimTargetDot(new.RecordType, added[0])
+		pairs = append(pairs, r)
+		unused, added = unused[1:], added[1:]
+	}
+
+	for _, existing := range pairs {
+		record := DNSRecord{
+			ID:         existing.ID,
+			Enabled:    enabled,
+			Key:        new.DNSName,
+			RecordType: new.RecordType,
+			TTL:        ttl,
+			Value:      existing.Value,
+		}
+		if i := slices.IndexFunc(records, func(r DNSRecord) bool { return r.ID == existing.ID }); i >= 0 {
+			if unchanged(records[i], record) {
+				continue
+			}
+			c.index.remove(records[i])
+		}
+
+		if new.RecordType == "SRV" {
+			if err := ParseSRVTarget(record.Value, &record); err != nil {
+				return err
+			}
+		}
+		err := c.updateRecord(ctx, record)
+		if isNotFound(err) {
+			// The record was deleted on the controller since it was listed, so it is created again.
+			log.Debug("updated record no longer exists, creating it", zap.String("id", record.ID), zap.String("name", record.Key), zap.String("type", record.RecordType))
+			added = append(added, existing.Value)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, target := range added {
+		created := new.DeepCopy()
+		created.Targets = endpoint.NewTargets(target)
+		if _, err := c.CreateEndpoint(created); err != nil {
+			return err
+		}
+	}
+
+	for _, record := range unused {
+		if err := c.deleteRecord(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unchanged reports whether updating the current record to the desired one would be a no-op.
+func unchanged(current, desired DNSRecord) bool {
+	return current.Enabled == desired.Enabled &&
+		current.TTL == desired.TTL &&
+		normalizeName(current.Key) == normalizeName(desired.Key) &&
+		normalizeTarget(current.RecordType, current.Value) == normalizeTarget(desired.RecordType, desired.Value)
+}
+
+// updateRecord replaces a single DNS record in the UniFi controller.
+func (c *httpClient) updateRecord(ctx context.Context, record DNSRecord) error {
+	jsonBody, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPut,
+		c.recordsURL(record.ID),
+		bytes.NewReader(jsonBody),
+	)
 	if err != nil {
 		return err
 	}
 
+	resp, err := c.do(req)
+	c.audit.record("update", c.site(), record, err)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.index.add(record)
 	return nil
 }
 
-// lookupIdentifier finds the ID of a DNS record in the UniFi controller.
-func (c *httpClient) lookupIdentifier(key, recordType string) (*DNSRecord, error) {
-	log.Debug("Looking up identifier", zap.String("key", key), zap.String("recordType", recordType))
+// lookupIdentifiers finds the DNS records in the UniFi controller matching the key, type and any of the targets.
+// It reports whether the records come from a listing taken during the current plan.
+func (c *httpClient) lookupIdentifiers(key, recordType string, targets endpoint.Targets) ([]DNSRecord, bool, error) {
+	log.Debug("Looking up identifiers", zap.String("key", key), zap.String("recordType", recordType), zap.Strings("targets", targets))
+	if records, ok, current := c.index.lookup(key, recordType, targets); ok {
+		return records, current, nil
+	}
+
 	records, err := c.GetEndpoints()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
+	// Records returns normalized endpoints, so the stored form is normalized before comparing.
+	var matches []DNSRecord
 	for _, r := range records {
-		if r.Key == key && r.RecordType == recordType {
-			return &r, nil
+		if normalizeName(r.Key) != normalizeName(key) || r.RecordType != recordType {
+			continue
 		}
+		for _, target := range targets {
+			if normalizeTarget(recordType, r.Value) == normalizeTarget(recordType, target) {
+				matches = append(matches, r)
+				break
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, false, fmt.Errorf("record not found: %s", key)
 	}
 
-	return nil, fmt.Errorf("record not found: %s", key)
+	return matches, true, nil
+}
+
+// rewindBody resets the request body so the request can be sent again.
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
 }
 
 // setHeaders sets the headers for the HTTP request.
 func (c *httpClient) setHeaders(req *http.Request) {
 	// Add the saved CSRF header.
-	req.Header.Set("X-CSRF-Token", c.csrf)
+	req.Header.Set("X-CSRF-Token", c.session.CSRF())
+	if c.apiKey != nil {
+		req.Header.Set("X-API-KEY", c.apiKey.Get())
+	}
+	req.Header.Set("User-Agent", userAgent(c.Config))
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json; charset=utf-8")
 }
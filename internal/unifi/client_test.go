@@ -0,0 +1,85 @@
+package unifi
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+)
+
+// blockingTransport holds the first listing until released.
+type blockingTransport struct {
+	http.RoundTripper
+	once     sync.Once
+	entered  chan struct{}
+	released chan struct{}
+}
+
+func (t *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	first := false
+	t.once.Do(func() { first = true })
+	if first {
+		close(t.entered)
+		<-t.released
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestGetEndpointsDoesNotWaitOnConcurrentListing(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	c.SetRecords("default", unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"})
+	client, err := newUnifiClient(newTestConfig(t, c, false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &blockingTransport{RoundTripper: client.Client.Transport, entered: make(chan struct{}), released: make(chan struct{})}
+	client.Client.Transport = transport
+	slow := make(chan error, 1)
+	go func() {
+		_, err := client.GetEndpoints()
+		slow <- err
+	}()
+	<-transport.entered
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetEndpoints()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("listing waited for the round trip of a concurrent listing")
+	}
+
+	close(transport.released)
+	if err := <-slow; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetEndpointsNotModified(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	client, err := newUnifiClient(newTestConfig(t, c, false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Inject(unifitest.Fault{Method: http.MethodGet, Path: "/static-dns/", Status: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}, Body: `[{"_id":"1","enabled":true,"key":"web.lan","record_type":"A","value":"10.0.0.1"}]`, Times: 1})
+	c.Inject(unifitest.Fault{Method: http.MethodGet, Path: "/static-dns/", Status: http.StatusNotModified, Body: " ", Times: 1})
+	for range 2 {
+		records, err := client.GetEndpoints()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].ID != "1" {
+			t.Errorf("records %+v, want the listed record", records)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package unifi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+)
+
+// eventually fails the test unless cond holds within a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+	}
+}
+
+func countSelf(requests []string) int {
+	var self int
+	for _, r := range requests {
+		if strings.HasSuffix(r, "/self") {
+			self++
+		}
+	}
+	return self
+}
+
+func TestCloseStopsKeepalive(t *testing.T) {
+	c := newTestController(t, unifitest.Options{Username: "admin", Password: "secret"})
+	config := newTestConfig(t, c, false, map[string]string{"UNIFI_SESSION_KEEPALIVE": "10ms"})
+	config.APIKey, config.User, config.Password = "", "admin", "secret"
+
+	client, err := newUnifiClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return countSelf(c.Requests()) > 0 })
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	closed := countSelf(c.Requests())
+	time.Sleep(50 * time.Millisecond)
+	if got := countSelf(c.Requests()); got != closed {
+		t.Errorf("keepalive sent %d requests after Close", got-closed)
+	}
+}
+
+func TestCloseStopsAPIKeyWatcher(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	file := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(file, []byte(testAPIKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := newTestConfig(t, c, false, map[string]string{"UNIFI_API_KEY_RELOAD_INTERVAL": "10ms"})
+	config.APIKey, config.APIKeyFile = "", file
+
+	client, err := newUnifiClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(file, []byte("rotated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return client.apiKey.Get() == "rotated" })
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(file, []byte("ignored"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := client.apiKey.Get(); got != "rotated" {
+		t.Errorf("api key reloaded after Close: got %q", got)
+	}
+}
+
+func TestCloseStopsConnectLoop(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	config := newTestConfig(t, c, false, map[string]string{"UNIFI_SITE": "missing"})
+
+	client, err := newUnifiClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Ready() == nil {
+		t.Fatal("client connected to a missing site")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.connectLoop(client.Ready())
+		close(done)
+	}()
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connect loop still running after Close")
+	}
+}
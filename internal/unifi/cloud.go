@@ -0,0 +1,37 @@
+package unifi
+
+import (
+	"fmt"
+)
+
+const (
+	// unifiCloudHost is the UniFi Site Manager API used to reach consoles through the cloud.
+	unifiCloudHost = "https://api.ui.com"
+	// unifiCloudConnectorPath proxies requests to a console, which then serves the UniFi OS paths.
+	unifiCloudConnectorPath = "/v1/connector/consoles"
+)
+
+// configureCloud points the configuration at the cloud connector of the selected console.
+// Cloud access authenticates with a Site Manager API key and always talks to a UniFi OS console.
+func configureCloud(config *Config) error {
+	if config.CloudConsoleID == "" {
+		return nil
+	}
+	if config.APIKey == "" && config.APIKeyFile == "" {
+		return fmt.Errorf("UNIFI_CLOUD_CONSOLE_ID requires a Site Manager api key")
+	}
+
+	host := config.Host
+	if host == "" {
+		host = unifiCloudHost
+	}
+	host, err := normalizeHost(host)
+	if err != nil {
+		return fmt.Errorf("invalid UNIFI_HOST %q: %w", config.Host, err)
+	}
+
+	config.Host = joinURL(host, unifiCloudConnectorPath, config.CloudConsoleID)
+	external := false
+	config.ExternalController = &external
+	return nil
+}
@@ -0,0 +1,142 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// compatFixtures are the synthetic controller responses under testdata/compat, one directory per
+// response shape, described in its README. Every listing holds the same records.
+var compatFixtures = []struct {
+	dir      string
+	external bool
+	backend  string
+}{
+	{dir: "unifi-os-zero-values", backend: RecordsBackendStaticDNS},
+	{dir: "unifi-os-omitted-fields", backend: RecordsBackendStaticDNS},
+	{dir: "unifi-os-dns-records-extra-fields", backend: RecordsBackendDNSRecords},
+	{dir: "self-hosted-zero-values", external: true, backend: RecordsBackendStaticDNS},
+}
+
+// compatRecords are the records every listing decodes to, as "type key value ttl enabled".
+var compatRecords = []string{
+	"A web.example.com 192.168.1.10 0 true",
+	"AAAA web.example.com fd00::10 300 true",
+	"CNAME www.example.com web.example.com 0 true",
+	"TXT example.com v=spf1 -all 0 true",
+	"SRV _sip._tcp.example.com 10 20 5060 sip.example.com 0 true",
+	"A old.example.com 192.168.1.99 0 false",
+}
+
+func readFixture(t *testing.T, dir, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "compat", dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func describeRecord(r DNSRecord) string {
+	return fmt.Sprintf("%s %s %s %d %t", r.RecordType, r.Key, r.Value, r.TTL, r.Enabled)
+}
+
+// newCompatClient connects a client to a fake controller answering with the fixtures of the directory.
+func newCompatClient(t *testing.T, dir string, external bool, backend string) (*httpClient, *unifitest.Controller) {
+	t.Helper()
+	c := newTestController(t, unifitest.Options{External: external})
+	c.Inject(unifitest.Fault{Method: http.MethodGet, Path: "/" + backend + "/", Status: http.StatusOK, Body: readFixture(t, dir, "list.json")})
+
+	client, err := newUnifiClient(newTestConfig(t, c, external, map[string]string{"UNIFI_RECORDS_BACKEND": backend}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, c
+}
+
+// recordPath is the path of a record on the controller.
+func recordPath(external bool, backend, id string) string {
+	network := unifiNetworkPath
+	if external {
+		network = unifiNetworkPathExternal
+	}
+	return network + unifiSitePath + "/default/" + backend + "/" + id
+}
+
+func TestCompatGetEndpoints(t *testing.T) {
+	for _, fixture := range compatFixtures {
+		t.Run(fixture.dir, func(t *testing.T) {
+			client, _ := newCompatClient(t, fixture.dir, fixture.external, fixture.backend)
+
+			records, err := client.GetEndpoints()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, r := range records {
+				if r.ID == "" {
+					t.Errorf("record without id: %s", describeRecord(r))
+				}
+				if r.RecordType == "SRV" && (r.Port != nil || r.Priority != nil || r.Weight != nil) {
+					t.Errorf("SRV fields not folded into the value: %s", describeRecord(r))
+				}
+				got = append(got, describeRecord(r))
+			}
+			if !slices.Equal(got, compatRecords) {
+				t.Errorf("decoded records:\n%q\nwant:\n%q", got, compatRecords)
+			}
+		})
+	}
+}
+
+func TestCompatCreateEndpoint(t *testing.T) {
+	for _, fixture := range compatFixtures {
+		t.Run(fixture.dir, func(t *testing.T) {
+			client, c := newCompatClient(t, fixture.dir, fixture.external, fixture.backend)
+			body := readFixture(t, fixture.dir, "create.json")
+			c.Inject(unifitest.Fault{Method: http.MethodPost, Path: "/" + fixture.backend + "/", Status: http.StatusOK, Body: body, Times: 1})
+
+			created, err := client.CreateEndpoint(endpoint.NewEndpoint("new.example.com", "A", "10.0.0.1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(created) != 1 {
+				t.Fatalf("created %d records, want 1", len(created))
+			}
+			if created[0].ID == "" || created[0].Key != "new.example.com" || created[0].Value != "10.0.0.1" {
+				t.Errorf("created record decoded as %+v from %s", *created[0], body)
+			}
+		})
+	}
+}
+
+func TestCompatDeleteEndpoint(t *testing.T) {
+	for _, fixture := range compatFixtures {
+		t.Run(fixture.dir, func(t *testing.T) {
+			client, c := newCompatClient(t, fixture.dir, fixture.external, fixture.backend)
+			records, err := client.GetEndpoints()
+			if err != nil {
+				t.Fatal(err)
+			}
+			i := slices.IndexFunc(records, func(r DNSRecord) bool { return r.RecordType == "CNAME" })
+			id := records[i].ID
+			c.Inject(unifitest.Fault{Method: http.MethodDelete, Path: "/" + fixture.backend + "/" + id, Status: http.StatusOK, Body: readFixture(t, fixture.dir, "delete.json"), Times: 1})
+
+			// The listing holds the target with or without the trailing dot, both must resolve.
+			if err := client.DeleteEndpoint(endpoint.NewEndpoint("www.example.com", "CNAME", "web.example.com.")); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Contains(c.Requests(), http.MethodDelete+" "+recordPath(fixture.external, fixture.backend, id)) {
+				t.Errorf("record %s not deleted, requests: %q", id, c.Requests())
+			}
+		})
+	}
+}
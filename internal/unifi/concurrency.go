@@ -0,0 +1,78 @@
+package unifi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// ConflictError is returned when a record changed on the controller since it was looked up,
+// so the operation on it is aborted instead of modifying the wrong entry.
+type ConflictError struct {
+	Operation string
+	Record    DNSRecord
+	Current   DNSRecord
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("refusing to %s record %s (%s %s %s): it was changed on the controller to %s %s %s",
+		e.Operation, e.Record.ID, e.Record.Key, e.Record.RecordType, e.Record.Value,
+		e.Current.Key, e.Current.RecordType, e.Current.Value)
+}
+
+// HTTPStatusCode returns the status code the webhook answers a conflicting change with.
+func (e *ConflictError) HTTPStatusCode() int {
+	return http.StatusConflict
+}
+
+// isNotFound reports whether the controller answered that the record does not exist.
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflictError reports whether err is caused by a record changed on the controller.
+func IsConflictError(err error) bool {
+	var target *ConflictError
+	return errors.As(err, &target)
+}
+
+// revalidate re-reads the records from the controller and splits the looked up records into the
+// ones still holding their key, type and value, and the conflicts. Records deleted in the meantime
+// are dropped without a conflict: deletes already reached the desired state, and updates create
+// the dropped records again.
+func (c *httpClient) revalidate(operation string, records []DNSRecord) ([]DNSRecord, error) {
+	current, err := c.GetEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]DNSRecord, len(current))
+	for _, r := range current {
+		byID[r.ID] = r
+	}
+
+	var valid []DNSRecord
+	var conflicts []error
+	for _, r := range records {
+		now, ok := byID[r.ID]
+		switch {
+		case !ok:
+			log.Debug("record already deleted", zap.String("operation", operation), zap.String("id", r.ID), zap.String("name", r.Key), zap.String("type", r.RecordType))
+		case normalizeName(now.Key) != normalizeName(r.Key) || now.RecordType != r.RecordType ||
+			normalizeTarget(r.RecordType, now.Value) != normalizeTarget(r.RecordType, r.Value):
+			conflicts = append(conflicts, &ConflictError{Operation: operation, Record: r, Current: now})
+		default:
+			valid = append(valid, now)
+		}
+	}
+
+	for _, err := range conflicts {
+		log.Warn("aborting operation on a record changed on the controller", zap.Error(err))
+		metrics.RecordConflictsTotal.WithLabelValues(operation).Inc()
+	}
+	return valid, errors.Join(conflicts...)
+}
@@ -0,0 +1,150 @@
+package unifi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// countListings returns the number of record listings among the requests.
+func countListings(requests []string) int {
+	var listings int
+	for _, r := range requests {
+		if strings.HasPrefix(r, http.MethodGet+" ") && strings.HasSuffix(r, "/static-dns/") {
+			listings++
+		}
+	}
+	return listings
+}
+
+func TestApplyChangesListsOncePerPlan(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	c.SetRecords("default",
+		unifitest.Record{Enabled: true, Key: "a.lan", RecordType: "A", Value: "10.0.0.1"},
+		unifitest.Record{Enabled: true, Key: "b.lan", RecordType: "A", Value: "10.0.0.2"},
+		unifitest.Record{Enabled: true, Key: "c.lan", RecordType: "A", Value: "10.0.0.3"},
+		unifitest.Record{Enabled: true, Key: "d.lan", RecordType: "A", Value: "10.0.0.4"},
+	)
+	p := newTestProvider(t, c, nil)
+
+	// A listing from before the plan fills the index.
+	if _, err := p.client.GetEndpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := len(c.Requests())
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("a.lan", "A", "10.0.0.1"),
+			endpoint.NewEndpoint("b.lan", "A", "10.0.0.2"),
+		},
+		UpdateOld: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("c.lan", "A", "10.0.0.3"),
+			endpoint.NewEndpoint("d.lan", "A", "10.0.0.4"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("c.lan", "A", "10.0.1.3"),
+			endpoint.NewEndpoint("d.lan", "A", "10.0.1.4"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listings := countListings(c.Requests()[before:]); listings != 1 {
+		t.Errorf("plan listed the controller %d times, want 1", listings)
+	}
+}
+
+func TestMissingRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   unifitest.Fault
+		changes plan.Changes
+		want    []string
+	}{
+		{
+			name:    "update of a record deleted during the plan",
+			fault:   unifitest.Fault{Method: http.MethodPut, Status: http.StatusNotFound, Times: 1},
+			changes: plan.Changes{UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "A", "10.0.0.1")}, UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "A", "10.0.0.2")}},
+			want:    []string{"web.lan A 10.0.0.1", "web.lan A 10.0.0.2"},
+		},
+		{
+			name:    "delete of a record deleted during the plan",
+			fault:   unifitest.Fault{Method: http.MethodDelete, Status: http.StatusNotFound, Times: 1},
+			changes: plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "A", "10.0.0.1")}},
+			want:    []string{"web.lan A 10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default", unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"})
+			p := newTestProvider(t, c, nil)
+			c.Inject(tt.fault)
+
+			if err := p.ApplyChanges(context.Background(), &tt.changes); err != nil {
+				t.Fatal(err)
+			}
+
+			// The fault answers without touching the store, so the original record is left behind.
+			var got []string
+			for _, r := range c.Records("default") {
+				got = append(got, r.Key+" "+r.RecordType+" "+r.Value)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("records %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateRevalidatesStaleIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []unifitest.Record
+		conflict bool
+		want     []string
+	}{
+		{name: "record deleted", want: []string{"web.lan A 10.0.0.3"}},
+		{
+			name:     "record changed",
+			current:  []unifitest.Record{{ID: "web", Enabled: true, Key: "other.lan", RecordType: "A", Value: "10.0.0.1"}},
+			conflict: true,
+			want:     []string{"other.lan A 10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default", unifitest.Record{ID: "web", Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"})
+			p := newTestProvider(t, c, nil)
+			if _, err := p.client.GetEndpoints(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The record changes on the controller after the listing, before the next plan.
+			c.SetRecords("default", tt.current...)
+			p.client.expireIndex()
+
+			err := p.client.UpdateEndpoint(context.Background(), endpoint.NewEndpoint("web.lan", "A", "10.0.0.1"), endpoint.NewEndpoint("web.lan", "A", "10.0.0.3"))
+			if IsConflictError(err) != tt.conflict || (err != nil && !tt.conflict) {
+				t.Errorf("UpdateEndpoint() error = %v, want conflict %t", err, tt.conflict)
+			}
+
+			var got []string
+			for _, r := range c.Records("default") {
+				got = append(got, r.Key+" "+r.RecordType+" "+r.Value)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("records %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package unifi
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	// CNAMEConflictPolicyReject refuses plans that would leave a CNAME next to other records.
+	CNAMEConflictPolicyReject = "reject"
+	// CNAMEConflictPolicyRepair deletes the existing records that conflict with the plan.
+	CNAMEConflictPolicyRepair = "repair"
+	// CNAMEConflictPolicyIgnore only reports conflicts.
+	CNAMEConflictPolicyIgnore = "ignore"
+)
+
+// recordState counts records per normalized name and type.
+type recordState map[string]map[string]int
+
+func (s recordState) add(name, recordType string, count int) {
+	name = normalizeName(name)
+	types, ok := s[name]
+	if !ok {
+		types = map[string]int{}
+		s[name] = types
+	}
+	types[recordType] = max(types[recordType]+count, 0)
+}
+
+// used reports whether any record is left for the normalized name.
+func (s recordState) used(name string) bool {
+	for _, count := range s[name] {
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// conflicts returns the sorted names that hold a CNAME alongside any other record type.
+// TXT records are ignored as external-dns places its registry records next to CNAMEs.
+func (s recordState) conflicts() []string {
+	var names []string
+	for name, types := range s {
+		if hasCNAMEConflict(types) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasCNAMEConflict(types map[string]int) bool {
+	if types["CNAME"] == 0 {
+		return false
+	}
+	for recordType, count := range types {
+		if recordType != "CNAME" && recordType != "TXT" && count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// detectControllerConflicts reports CNAME conflicts that already exist on the controller of the tenant.
+func detectControllerConflicts(tenant string, records []DNSRecord) {
+	state := recordState{}
+	for _, r := range records {
+		state.add(r.Key, r.RecordType, 1)
+	}
+
+	conflicts := state.conflicts()
+	metrics.ControllerCNAMEConflicts.WithLabelValues(tenant).Set(float64(len(conflicts)))
+	if len(conflicts) > 0 {
+		log.Warn("controller holds CNAME records alongside other record types", zap.Strings("names", conflicts))
+	}
+}
+
+// validateCNAMEConflicts checks that applying the changes does not leave a CNAME next to other
+// records for the same name, and rejects or repairs the plan according to the configured policy.
+func (p *Provider) validateCNAMEConflicts(changes *plan.Changes) error {
+	records, err := p.client.GetEndpoints()
+	if err != nil {
+		return err
+	}
+
+	state := recordState{}
+	for _, r := range records {
+		state.add(r.Key, r.RecordType, 1)
+	}
+
+	deleted := map[string]bool{}
+	for _, ep := range append(changes.UpdateOld, changes.Delete...) {
+		state.add(ep.DNSName, ep.RecordType, -len(ep.Targets))
+		for _, target := range ep.Targets {
+			deleted[indexKey(ep.DNSName, ep.RecordType, target)] = true
+		}
+	}
+
+	planned := recordState{}
+	for _, ep := range append(changes.Create, changes.UpdateNew...) {
+		state.add(ep.DNSName, ep.RecordType, len(ep.Targets))
+		planned.add(ep.DNSName, ep.RecordType, len(ep.Targets))
+	}
+
+	conflicts := state.conflicts()
+	if len(conflicts) == 0 {
+		return nil
+	}
+	metrics.CNAMEConflictsTotal.Add(float64(len(conflicts)))
+
+	switch p.config.CNAMEConflictPolicy {
+	case CNAMEConflictPolicyIgnore:
+		log.Warn("plan leaves CNAME records alongside other record types", zap.Strings("names", conflicts))
+		return nil
+	case CNAMEConflictPolicyRepair:
+		if p.config.DisableDeletes {
+			return rejectPlanDetails("cname_conflict", conflicts, "plan leaves CNAME records alongside other record types for: %s, repairing them requires deletes, which are disabled", strings.Join(conflicts, ", "))
+		}
+		for _, name := range conflicts {
+			if hasCNAMEConflict(planned[name]) {
+				return rejectPlan("cname_conflict", "plan creates a CNAME alongside other record types for %s", name)
+			}
+
+			// Records created by the plan win over the ones already on the controller.
+			keepCNAME := planned[name]["CNAME"] > 0
+			for _, r := range records {
+				if normalizeName(r.Key) != name || r.RecordType == "TXT" || (r.RecordType == "CNAME") == keepCNAME {
+					continue
+				}
+				if deleted[indexKey(r.Key, r.RecordType, r.Value)] {
+					continue
+				}
+
+				log.Warn("removing conflicting record", zap.String("name", r.Key), zap.String("type", r.RecordType), zap.String("value", r.Value))
+				changes.Delete = append(changes.Delete, endpoint.NewEndpoint(r.Key, r.RecordType, r.Value))
+			}
+		}
+		return nil
+	default:
+		return rejectPlanDetails("cname_conflict", conflicts, "plan leaves CNAME records alongside other record types for: %s", strings.Join(conflicts, ", "))
+	}
+}
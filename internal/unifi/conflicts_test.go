@@ -0,0 +1,115 @@
+package unifi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestCNAMEConflictsWithDisabledDeletes(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         string
+		disableDeletes bool
+		changes        plan.Changes
+		rejected       bool
+		want           []string
+	}{
+		{
+			name:    "repair deletes the conflicting record",
+			policy:  CNAMEConflictPolicyRepair,
+			changes: plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "CNAME", "other.lan")}},
+			want:    []string{"web.lan CNAME other.lan"},
+		},
+		{
+			name:           "repair rejects while deletes are disabled",
+			policy:         CNAMEConflictPolicyRepair,
+			disableDeletes: true,
+			changes:        plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "CNAME", "other.lan")}},
+			rejected:       true,
+			want:           []string{"web.lan A 10.0.0.1"},
+		},
+		{
+			name:           "reject accounts for the skipped delete",
+			policy:         CNAMEConflictPolicyReject,
+			disableDeletes: true,
+			changes: plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "CNAME", "other.lan")},
+				Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "A", "10.0.0.1")},
+			},
+			rejected: true,
+			want:     []string{"web.lan A 10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default", unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"})
+			environment := map[string]string{"UNIFI_CNAME_CONFLICT_POLICY": tt.policy}
+			if tt.disableDeletes {
+				environment["UNIFI_DISABLE_DELETES"] = "true"
+			}
+			p := newTestProvider(t, c, environment)
+
+			err := p.ApplyChanges(context.Background(), &tt.changes)
+			var rejected *PlanRejectedError
+			if errors.As(err, &rejected) != tt.rejected || (err != nil && !tt.rejected) {
+				t.Errorf("ApplyChanges() error = %v, want rejected %t", err, tt.rejected)
+			}
+
+			var got []string
+			for _, r := range c.Records("default") {
+				got = append(got, r.Key+" "+r.RecordType+" "+r.Value)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("records %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCNAMERepairCountsAgainstLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		rejected bool
+	}{
+		{name: "within the limits", env: map[string]string{"UNIFI_MAX_DELETES": "2", "UNIFI_MAX_CHANGES": "3"}},
+		{name: "too many deletes", env: map[string]string{"UNIFI_MAX_DELETES": "1"}, rejected: true},
+		{name: "too many changes", env: map[string]string{"UNIFI_MAX_CHANGES": "2"}, rejected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default",
+				unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+				unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "AAAA", Value: "fd00::1"},
+			)
+			tt.env["UNIFI_CNAME_CONFLICT_POLICY"] = CNAMEConflictPolicyRepair
+			p := newTestProvider(t, c, tt.env)
+
+			err := p.ApplyChanges(context.Background(), &plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("web.lan", "CNAME", "other.lan")},
+			})
+			var rejected *PlanRejectedError
+			if errors.As(err, &rejected) != tt.rejected || (err != nil && !tt.rejected) {
+				t.Errorf("ApplyChanges() error = %v, want rejected %t", err, tt.rejected)
+			}
+			// The CNAME replaces both records unless the plan is rejected.
+			want := 1
+			if tt.rejected {
+				want = 2
+			}
+			if got := len(c.Records("default")); got != want {
+				t.Errorf("controller holds %d records, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package unifi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+const (
+	connectRetryMinInterval = 5 * time.Second
+	connectRetryMaxInterval = 5 * time.Minute
+)
+
+// connection tracks whether the client has established its session with the controller.
+type connection struct {
+	sync.RWMutex
+	connected bool
+	err       error
+}
+
+// fail records why the client is not connected, reported by Ready until a connection succeeds.
+func (c *connection) fail(err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.err = err
+}
+
+// controllerLayout is what connecting learns about the controller. Requests read the current
+// layout while connect may run in the background, so a published layout is never modified.
+type controllerLayout struct {
+	external bool
+	urls     *ClientURLs
+	version  controllerVersion
+	// site is the internal name of the configured site, which may be a display name.
+	site string
+}
+
+// newControllerLayout returns the layout assumed from the configuration until connect has run.
+func newControllerLayout(config *Config) controllerLayout {
+	external := config.ExternalController != nil && *config.ExternalController
+	return controllerLayout{
+		external: external,
+		urls:     newClientURLs(external, config.RecordsBackend),
+		site:     config.Site,
+	}
+}
+
+// publish makes a copy of the layout the current one.
+func (c *httpClient) publish(layout controllerLayout) {
+	c.layout.Store(&layout)
+}
+
+// connect detects the controller layout and version, establishes the session and selects the records backend.
+// Each step publishes what it learned, as the following steps send their requests with the current layout.
+func (c *httpClient) connect() error {
+	layout := *c.layout.Load()
+	if c.Config.ExternalController != nil {
+		layout.external = *c.Config.ExternalController
+	} else {
+		external, err := c.detectExternalController()
+		if err != nil {
+			return fmt.Errorf("failed to detect the controller type, set UNIFI_EXTERNAL_CONTROLLER to skip detection: %w", err)
+		}
+		log.Info("detected controller type", zap.Bool("external", external))
+		layout.external = external
+	}
+	layout.urls = newClientURLs(layout.external, c.Config.RecordsBackend)
+	c.publish(layout)
+
+	// API keys are sent with every request, so there is no session to establish.
+	if c.apiKey == nil {
+		if err := c.login(); err != nil {
+			return err
+		}
+	}
+
+	site, err := c.resolveSite()
+	if err != nil {
+		return err
+	}
+	layout.site = site
+	c.publish(layout)
+
+	version, err := c.detectVersion()
+	if err != nil {
+		log.Warn("failed to detect the network application version", zap.Error(err))
+	}
+	layout.version = version
+
+	if c.Config.RecordsBackend == RecordsBackendAuto {
+		backend := RecordsBackendStaticDNS
+		// Controllers older than the DNS records API are not probed.
+		if err != nil || !version.Less(dnsRecordsVersion) {
+			backend = c.detectRecordsBackend()
+		}
+		log.Info("selected dns records backend", zap.String("backend", backend))
+		layout.urls = newClientURLs(layout.external, backend)
+	}
+	c.publish(layout)
+
+	c.connection.Lock()
+	defer c.connection.Unlock()
+	c.connection.connected = true
+	c.connection.err = nil
+	return nil
+}
+
+// initialConnect connects to the controller, waiting at most the connect timeout so an unreachable
+// controller does not hold up startup. Connecting is retried in the background when it fails.
+func (c *httpClient) initialConnect() {
+	log.Info("connecting to the unifi controller", zap.String("host", c.Config.Host))
+
+	done := make(chan error, 1)
+	go func() { done <- c.connect() }()
+
+	var timeout <-chan time.Time
+	if c.Config.ConnectTimeout > 0 {
+		timer := time.NewTimer(c.Config.ConnectTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Error("failed to connect to the unifi controller, retrying in the background", zap.Error(err))
+			c.connection.fail(err)
+			go c.connectLoop(err)
+		}
+	case <-timeout:
+		err := fmt.Errorf("no answer from the unifi controller at %s within %s, check that UNIFI_HOST is reachable", c.Config.Host, c.Config.ConnectTimeout)
+		log.Error("failed to connect to the unifi controller, retrying in the background", zap.Error(err))
+		c.connection.fail(err)
+		go func() {
+			select {
+			case <-c.ctx.Done():
+			case err := <-done:
+				if err != nil {
+					c.connectLoop(err)
+				}
+			}
+		}()
+	}
+}
+
+// connectLoop retries connecting to the controller with an exponential backoff until it succeeds
+// or the client is closed.
+func (c *httpClient) connectLoop(err error) {
+	interval := connectRetryMinInterval
+	for {
+		c.connection.fail(err)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err = c.connect(); err == nil {
+			log.Info("connected to the unifi controller")
+			return
+		}
+
+		interval = min(interval*2, connectRetryMaxInterval)
+		var rateLimited *RateLimitError
+		if errors.As(err, &rateLimited) {
+			interval = max(interval, rateLimited.RetryAfter)
+		}
+		log.Error("failed to connect to the unifi controller", zap.Error(err), zap.Duration("retry_in", interval))
+	}
+}
+
+// Ready returns an error until the client has connected to the controller.
+func (c *httpClient) Ready() error {
+	c.connection.RLock()
+	defer c.connection.RUnlock()
+
+	if c.connection.connected {
+		return nil
+	}
+	if c.connection.err != nil {
+		return fmt.Errorf("not connected to the unifi controller: %w", c.connection.err)
+	}
+	return fmt.Errorf("not connected to the unifi controller")
+}
@@ -0,0 +1,52 @@
+package unifi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+)
+
+func TestReadyReportsInitialConnectError(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	config := newTestConfig(t, c, false, map[string]string{"UNIFI_SITE": "missing"})
+
+	client, err := newUnifiClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	err = client.Ready()
+	if err == nil {
+		t.Fatal("client connected to a missing site")
+	}
+	if !strings.Contains(err.Error(), `site "missing" not found`) {
+		t.Errorf("Ready() = %v, want the connect error", err)
+	}
+}
+
+func TestConnectPublishesLayoutWhileReading(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	p := newTestProvider(t, c, nil)
+	client := p.client.(*httpClient)
+
+	done := make(chan error, 1)
+	go func() { done <- client.connect() }()
+	for reading := true; reading; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			reading = false
+		default:
+		}
+		client.recordsURL("")
+		p.Status()
+	}
+
+	if got, want := client.recordsURL(""), c.URL+"/proxy/network/v2/api/site/default/static-dns/"; got != want {
+		t.Errorf("recordsURL() = %q, want %q", got, want)
+	}
+}
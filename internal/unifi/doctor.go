@@ -0,0 +1,169 @@
+package unifi
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// doctorProbeName is the name of the TXT record created and deleted to check write permission.
+const doctorProbeName = "_external-dns-unifi-webhook-doctor.invalid"
+
+// DoctorCheck is the outcome of a single diagnostic check.
+type DoctorCheck struct {
+	Name    string
+	Detail  string
+	Err     error
+	Skipped bool
+}
+
+// Doctor runs live checks against the configured controller, from name resolution up to
+// creating and deleting a probe record. Checks depending on a failed one are skipped.
+func Doctor(config *Config) []DoctorCheck {
+	var checks []DoctorCheck
+	failed := false
+	run := func(name string, check func() (string, error)) {
+		if failed {
+			checks = append(checks, DoctorCheck{Name: name, Skipped: true})
+			return
+		}
+		detail, err := check()
+		checks = append(checks, DoctorCheck{Name: name, Detail: detail, Err: err})
+		failed = err != nil
+	}
+
+	// The client rewrites the host in its configuration, so the network checks work on a copy.
+	probe := *config
+	var u *url.URL
+	run("configuration", func() (string, error) {
+		host := probe.Host
+		if probe.CloudConsoleID != "" {
+			if err := configureCloud(&probe); err != nil {
+				return "", err
+			}
+		} else {
+			normalized, err := normalizeHost(host)
+			if err != nil {
+				return "", fmt.Errorf("invalid UNIFI_HOST %q: %w", host, err)
+			}
+			probe.Host = normalized
+		}
+
+		var err error
+		u, err = url.Parse(probe.Host)
+		return probe.Host, err
+	})
+
+	run("dns resolution", func() (string, error) {
+		if ip := net.ParseIP(u.Hostname()); ip != nil {
+			return "host is an IP address", nil
+		}
+		addrs, err := net.LookupHost(u.Hostname())
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(addrs, ", "), nil
+	})
+
+	run("tcp/tls connectivity", func() (string, error) {
+		port := u.Port()
+		if port == "" {
+			port = "443"
+			if u.Scheme == "http" {
+				port = "80"
+			}
+		}
+		address := net.JoinHostPort(u.Hostname(), port)
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+		if u.Scheme == "http" {
+			conn, err := dialer.Dial("tcp", address)
+			if err != nil {
+				return "", err
+			}
+			conn.Close()
+			return address, nil
+		}
+
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return "", err
+		}
+		tlsConfig.ServerName = u.Hostname()
+
+		conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+
+		state := conn.ConnectionState()
+		detail := fmt.Sprintf("%s, %s", address, tls.VersionName(state.Version))
+		switch {
+		case len(config.TLSFingerprints) > 0:
+			detail += ", certificate fingerprint pinned"
+		case config.SkipTLSVerify && len(state.PeerCertificates) > 0:
+			sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+			detail += ", certificate not verified, pin it with UNIFI_TLS_FINGERPRINT=" + hex.EncodeToString(sum[:])
+		}
+		return detail, nil
+	})
+
+	var c *httpClient
+	run("authentication", func() (string, error) {
+		var err error
+		if c, err = newUnifiClient(config); err != nil {
+			return "", err
+		}
+		if err := c.Ready(); err != nil {
+			return "", err
+		}
+		if c.apiKey != nil {
+			return "api key", nil
+		}
+		return "username and password", nil
+	})
+
+	run("site", func() (string, error) {
+		sites, err := c.listSites()
+		if err != nil {
+			return "", err
+		}
+		var names []string
+		for _, site := range sites {
+			if site.Name == config.Site {
+				return fmt.Sprintf("%s (%s)", site.Name, site.Description), nil
+			}
+			names = append(names, site.Name)
+		}
+		return "", fmt.Errorf("site %q not found, available sites: %s", config.Site, strings.Join(names, ", "))
+	})
+
+	run("records read", func() (string, error) {
+		records, err := c.GetEndpoints()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d records", len(records)), nil
+	})
+
+	run("records write", func() (string, error) {
+		ep := endpoint.NewEndpoint(doctorProbeName, "TXT", "external-dns-unifi-webhook doctor probe")
+		if _, err := c.CreateEndpoint(ep); err != nil {
+			return "", fmt.Errorf("failed to create probe record: %w", err)
+		}
+		if err := c.DeleteEndpoint(ep); err != nil {
+			return "", fmt.Errorf("failed to delete probe record %s, remove it manually: %w", doctorProbeName, err)
+		}
+		return "created and deleted " + doctorProbeName, nil
+	})
+
+	return checks
+}
@@ -0,0 +1,76 @@
+package unifi
+
+import (
+	"context"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// findDuplicates splits the records into the first record of every name, type and value,
+// and the exact duplicates of those, which crashes in the middle of an apply can leave behind.
+func findDuplicates(records []DNSRecord) (unique, duplicates []DNSRecord) {
+	seen := map[string]bool{}
+	for _, r := range records {
+		key := indexKey(r.Key, r.RecordType, r.Value)
+		if seen[key] {
+			duplicates = append(duplicates, r)
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, r)
+	}
+	return unique, duplicates
+}
+
+// pruneDuplicates deletes the exact duplicates from the controller and returns the remaining records.
+// Protected records are left untouched.
+func (p *Provider) pruneDuplicates(records []DNSRecord) ([]DNSRecord, error) {
+	unique, duplicates := findDuplicates(records)
+	if len(duplicates) == 0 {
+		return records, nil
+	}
+
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+
+	removed := 0
+	for _, r := range duplicates {
+		if p.protected.Match(r.Key) {
+			unique = append(unique, r)
+			continue
+		}
+
+		log.Info("deleting duplicate record", zap.String("name", r.Key), zap.String("type", r.RecordType), zap.String("value", r.Value), zap.String("id", r.ID))
+		if err := p.client.deleteRecord(r); err != nil {
+			metrics.DuplicatesRemovedTotal.Add(float64(removed))
+			return nil, err
+		}
+		removed++
+	}
+
+	metrics.DuplicatesRemovedTotal.Add(float64(removed))
+	return unique, nil
+}
+
+// PruneDuplicates deletes the exact duplicate records from the controller on demand
+// and returns the number of records deleted.
+func (p *Provider) PruneDuplicates(ctx context.Context) (int, error) {
+	if !IsLeader() {
+		return 0, &NotLeaderError{}
+	}
+
+	records, err := p.client.GetEndpoints()
+	if err != nil {
+		return 0, err
+	}
+
+	remaining, err := p.pruneDuplicates(records)
+	if err != nil {
+		return 0, err
+	}
+	_, duplicates := findDuplicates(remaining)
+	metrics.DuplicateRecords.WithLabelValues(p.config.Tenant).Set(float64(len(duplicates)))
+	return len(records) - len(remaining), nil
+}
@@ -0,0 +1,155 @@
+package unifi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Error classes reported in metrics.
+const (
+	ErrorClassAuth        = "auth"
+	ErrorClassNetwork     = "network"
+	ErrorClassAPI         = "api"
+	ErrorClassData        = "data"
+	ErrorClassRateLimit   = "rate_limit"
+	ErrorClassUnavailable = "unavailable"
+	ErrorClassRejected    = "rejected"
+	ErrorClassConflict    = "conflict"
+	ErrorClassOther       = "other"
+)
+
+// AuthError is returned when the controller rejects the credentials.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return "authentication failed: " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusCode reports rejected controller credentials as an upstream failure.
+func (e *AuthError) HTTPStatusCode() int {
+	return http.StatusBadGateway
+}
+
+// NetworkError is returned when the controller cannot be reached.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "network error: " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusCode reports a timed out controller request as gateway timeout, any other
+// network failure as an upstream failure.
+func (e *NetworkError) HTTPStatusCode() int {
+	var netErr net.Error
+	if errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// APIError is returned when the controller answers a request with an unexpected status.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s request to %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// HTTPStatusCode reports records refused by the controller as invalid request, as retrying
+// the same change cannot succeed, and any other unexpected status as an upstream failure.
+func (e *APIError) HTTPStatusCode() int {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// DataError is returned when the controller response cannot be decoded.
+type DataError struct {
+	Err error
+}
+
+func (e *DataError) Error() string {
+	return "invalid controller response: " + e.Err.Error()
+}
+
+func (e *DataError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusCode reports an undecodable controller response as an upstream failure.
+func (e *DataError) HTTPStatusCode() int {
+	return http.StatusBadGateway
+}
+
+// IsAuthError reports whether err is caused by rejected credentials.
+func IsAuthError(err error) bool {
+	var target *AuthError
+	return errors.As(err, &target)
+}
+
+// IsNetworkError reports whether err is caused by an unreachable controller.
+func IsNetworkError(err error) bool {
+	var target *NetworkError
+	return errors.As(err, &target)
+}
+
+// IsAPIError reports whether err is caused by an unexpected controller response status.
+func IsAPIError(err error) bool {
+	var target *APIError
+	return errors.As(err, &target)
+}
+
+// IsDataError reports whether err is caused by an undecodable controller response.
+func IsDataError(err error) bool {
+	var target *DataError
+	return errors.As(err, &target)
+}
+
+// errorClass returns the metrics class of an error.
+func errorClass(err error) string {
+	var rateLimited *RateLimitError
+	var unavailable *UnavailableError
+	var rejected *PlanRejectedError
+	switch {
+	case IsAuthError(err):
+		return ErrorClassAuth
+	case IsNetworkError(err):
+		return ErrorClassNetwork
+	case errors.As(err, &rateLimited):
+		return ErrorClassRateLimit
+	case errors.As(err, &unavailable):
+		return ErrorClassUnavailable
+	case IsAPIError(err):
+		return ErrorClassAPI
+	case IsDataError(err):
+		return ErrorClassData
+	case errors.As(err, &rejected):
+		return ErrorClassRejected
+	case IsConflictError(err):
+		return ErrorClassConflict
+	default:
+		return ErrorClassOther
+	}
+}
@@ -0,0 +1,12 @@
+package unifi
+
+// Reasons of the events reported on provider failures.
+const (
+	EventLoginFailed   = "LoginFailed"
+	EventPlanRejected  = "PlanRejected"
+	EventCircuitOpened = "CircuitOpened"
+)
+
+// RecordEvent reports a provider failure outside of the logs. It is replaced by the
+// Kubernetes event recorder when events are enabled.
+var RecordEvent = func(reason, message string) {}
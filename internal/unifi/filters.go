@@ -0,0 +1,201 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	// IPv6PolicyBoth publishes A and AAAA records.
+	IPv6PolicyBoth = "both"
+	// IPv6PolicyDrop never publishes AAAA records.
+	IPv6PolicyDrop = "drop"
+	// IPv6PolicyPreferIPv4 only publishes AAAA records for names without an A record.
+	IPv6PolicyPreferIPv4 = "prefer-ipv4"
+)
+
+// validateIPv6Policy checks that the configured IPv6 policy is known.
+func validateIPv6Policy(policy string) error {
+	switch policy {
+	case IPv6PolicyBoth, IPv6PolicyDrop, IPv6PolicyPreferIPv4:
+		return nil
+	default:
+		return fmt.Errorf("unknown ipv6 policy: %s", policy)
+	}
+}
+
+// Reasons reported by the filtered endpoints metric.
+const (
+	filterReasonDomain      = "domain_filter"
+	filterReasonRecordType  = "record_type"
+	filterReasonIPv6Policy  = "ipv6_policy"
+	filterReasonTargetNet   = "target_net"
+	filterReasonTargetRegex = "target_regex"
+)
+
+// filterIPv6 drops AAAA endpoints according to the IPv6 policy.
+func filterIPv6(policy string, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if policy == IPv6PolicyBoth {
+		return endpoints
+	}
+
+	hasA := map[string]bool{}
+	for _, ep := range endpoints {
+		if ep.RecordType == endpoint.RecordTypeA {
+			hasA[ep.DNSName] = true
+		}
+	}
+
+	var filtered []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if ep.RecordType == endpoint.RecordTypeAAAA && (policy == IPv6PolicyDrop || hasA[ep.DNSName]) {
+			log.Debug("dropping AAAA endpoint due to ipv6 policy", zap.String("name", ep.DNSName), zap.String("policy", policy))
+			metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonIPv6Policy).Inc()
+			continue
+		}
+		filtered = append(filtered, ep)
+	}
+	return filtered
+}
+
+// filterTargetNets drops A and AAAA targets outside the target net filter, and endpoints left without targets.
+func filterTargetNets(filter endpoint.TargetNetFilter, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	var filtered []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if ep.RecordType != endpoint.RecordTypeA && ep.RecordType != endpoint.RecordTypeAAAA {
+			filtered = append(filtered, ep)
+			continue
+		}
+
+		var targets endpoint.Targets
+		for _, target := range ep.Targets {
+			if !filter.Match(target) {
+				log.Debug("dropping target outside the target net filter", zap.String("name", ep.DNSName), zap.String("target", target))
+				continue
+			}
+			targets = append(targets, target)
+		}
+		if len(targets) == 0 {
+			metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonTargetNet).Inc()
+			continue
+		}
+
+		ep.Targets = targets
+		filtered = append(filtered, ep)
+	}
+	return filtered
+}
+
+// supportedRecordTypes are the record types the UniFi controller can store.
+var supportedRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "SRV", "TXT"}
+
+// filterUnsupported drops endpoints with record types the controller cannot store,
+// so external-dns does not keep planning changes that can never be applied.
+func filterUnsupported(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	var filtered []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if !slices.Contains(supportedRecordTypes, ep.RecordType) {
+			log.Debug("dropping endpoint with record type unsupported by unifi", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+			metrics.UnsupportedEndpointsSkippedTotal.WithLabelValues(ep.RecordType).Inc()
+			continue
+		}
+		filtered = append(filtered, ep)
+	}
+	return filtered
+}
+
+// recordTypes is the allowlist of record types the provider manages, empty allows every type.
+type recordTypes []string
+
+// newRecordTypes normalizes the configured record types.
+func newRecordTypes(types []string) recordTypes {
+	var allowed recordTypes
+	for _, t := range types {
+		if t = strings.ToUpper(strings.TrimSpace(t)); t != "" {
+			allowed = append(allowed, t)
+		}
+	}
+	return allowed
+}
+
+// Allowed reports whether the record type is managed by the provider.
+func (t recordTypes) Allowed(recordType string) bool {
+	return len(t) == 0 || slices.Contains(t, recordType)
+}
+
+// filterEndpoints drops endpoints with record types outside the allowlist.
+func (t recordTypes) filterEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if len(t) == 0 {
+		return endpoints
+	}
+
+	var filtered []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if !t.Allowed(ep.RecordType) {
+			log.Debug("dropping endpoint with record type outside the allowlist", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+			metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonRecordType).Inc()
+			continue
+		}
+		filtered = append(filtered, ep)
+	}
+	return filtered
+}
+
+// filterChanges drops changes with record types outside the allowlist.
+func (t recordTypes) filterChanges(changes *plan.Changes) {
+	changes.Create = t.filterEndpoints(changes.Create)
+	changes.UpdateOld = t.filterEndpoints(changes.UpdateOld)
+	changes.UpdateNew = t.filterEndpoints(changes.UpdateNew)
+	changes.Delete = t.filterEndpoints(changes.Delete)
+}
+
+// filterTargetRegex drops targets matching the exclusion regex, and endpoints left without targets.
+func filterTargetRegex(exclusion *regexp.Regexp, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if exclusion == nil {
+		return endpoints
+	}
+
+	var filtered []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		var targets endpoint.Targets
+		for _, target := range ep.Targets {
+			if exclusion.MatchString(target) {
+				log.Debug("dropping target matching the target exclusion regex", zap.String("name", ep.DNSName), zap.String("target", target))
+				continue
+			}
+			targets = append(targets, target)
+		}
+		if len(targets) == 0 {
+			metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonTargetRegex).Inc()
+			continue
+		}
+
+		ep.Targets = targets
+		filtered = append(filtered, ep)
+	}
+	return filtered
+}
+
+// negotiableDomainFilter returns the domain filter as external-dns receives it on negotiation, so the
+// provider enforces exactly the filter external-dns plans with. Serializing also sorts the domain
+// lists once, which the serialization would otherwise do in place on every negotiation.
+func negotiableDomainFilter(filter endpoint.DomainFilter) (endpoint.DomainFilter, error) {
+	b, err := json.Marshal(filter)
+	if err != nil {
+		return endpoint.DomainFilter{}, fmt.Errorf("failed to serialize the domain filter: %w", err)
+	}
+	var negotiated endpoint.DomainFilter
+	if err := json.Unmarshal(b, &negotiated); err != nil {
+		return endpoint.DomainFilter{}, fmt.Errorf("domain filter %s does not survive serialization: %w", b, err)
+	}
+	return negotiated, nil
+}
@@ -0,0 +1,93 @@
+package unifi
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// negotiationNames are matched against every domain filter before and after negotiation.
+var negotiationNames = []string{
+	"example.com",
+	"www.example.com",
+	"WWW.Example.com.",
+	"db.example.com",
+	"db.internal.example.com",
+	"www.example.org",
+	"nas.home.lan.",
+	"lan",
+}
+
+func TestDomainFilterNegotiation(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter endpoint.DomainFilter
+	}{
+		{
+			name:   "include list",
+			filter: endpoint.NewDomainFilter([]string{"example.com", "home.lan"}),
+		},
+		{
+			name:   "include list with exclusions",
+			filter: endpoint.NewDomainFilterWithExclusions([]string{"example.com"}, []string{"internal.example.com"}),
+		},
+		{
+			name:   "exclusions alone",
+			filter: endpoint.NewDomainFilterWithExclusions(nil, []string{"internal.example.com"}),
+		},
+		{
+			name:   "regex",
+			filter: endpoint.NewRegexDomainFilter(regexp.MustCompile(`\.example\.com$`), nil),
+		},
+		{
+			name:   "regex with exclusion regex",
+			filter: endpoint.NewRegexDomainFilter(regexp.MustCompile(`\.example\.com$`), regexp.MustCompile(`^db\.`)),
+		},
+		{
+			name:   "exclusion regex alone",
+			filter: endpoint.NewRegexDomainFilter(nil, regexp.MustCompile(`^db\.`)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			config := newTestConfig(t, c, false, nil)
+			p, err := NewUnifiProvider(tt.filter, endpoint.TargetNetFilter{}, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Serialized as the negotiate handler does, decoded as the external-dns webhook provider does.
+			b, err := json.Marshal(p.GetDomainFilter())
+			if err != nil {
+				t.Fatal(err)
+			}
+			negotiated := endpoint.DomainFilter{}
+			if err := json.NewDecoder(bytes.NewReader(b)).Decode(&negotiated); err != nil {
+				t.Fatalf("external-dns cannot decode %s: %v", b, err)
+			}
+
+			enforced := p.(*Provider).domainFilter
+			for _, name := range negotiationNames {
+				want := tt.filter.Match(name)
+				if negotiated.Match(name) != want || enforced.Match(name) != want {
+					t.Errorf("%s: negotiated match %t, enforced match %t, configured match %t", name, negotiated.Match(name), enforced.Match(name), want)
+				}
+			}
+
+			// Negotiating again must send the same filter.
+			again, err := json.Marshal(p.GetDomainFilter())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, again) {
+				t.Errorf("negotiated %s, then %s", b, again)
+			}
+		})
+	}
+}
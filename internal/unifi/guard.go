@@ -0,0 +1,110 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// PlanRejectedError is returned when a plan is refused before any change is applied.
+type PlanRejectedError struct {
+	Reason  string
+	Message string
+	// Details lists the changes or names the plan was rejected for, if any.
+	Details []string
+}
+
+func (e *PlanRejectedError) Error() string {
+	return "plan rejected: " + e.Message
+}
+
+// HTTPStatusCode returns the status code the webhook answers a rejected plan with.
+func (e *PlanRejectedError) HTTPStatusCode() int {
+	return http.StatusBadRequest
+}
+
+// ErrorCode returns the reason of the rejection as error code of the webhook response.
+func (e *PlanRejectedError) ErrorCode() string {
+	return e.Reason
+}
+
+// ErrorDetails returns the changes or names the plan was rejected for.
+func (e *PlanRejectedError) ErrorDetails() []string {
+	return e.Details
+}
+
+// rejectPlan counts and returns a rejected plan error.
+func rejectPlan(reason, format string, args ...any) error {
+	return rejectPlanDetails(reason, nil, format, args...)
+}
+
+// rejectPlanDetails counts and returns a rejected plan error listing the offending changes or names.
+func rejectPlanDetails(reason string, details []string, format string, args ...any) error {
+	metrics.PlansRejectedTotal.WithLabelValues(reason).Inc()
+	err := &PlanRejectedError{Reason: reason, Message: fmt.Sprintf(format, args...), Details: details}
+	RecordEvent(EventPlanRejected, err.Error())
+	return err
+}
+
+// checkMaxChanges rejects plans exceeding the configured number of deletes or total changes.
+func (p *Provider) checkMaxChanges(changes *plan.Changes) error {
+	deletes := len(changes.Delete)
+	total := len(changes.Create) + len(changes.UpdateNew) + len(changes.Delete)
+
+	if max := p.config.MaxDeletes; max > 0 && deletes > max {
+		log.Error("REFUSING PLAN: too many deletes, check the external-dns sources", zap.Int("deletes", deletes), zap.Int("max_deletes", max))
+		return rejectPlan("max_deletes", "%d deletes exceed the limit of %d", deletes, max)
+	}
+	if max := p.config.MaxChanges; max > 0 && total > max {
+		log.Error("REFUSING PLAN: too many changes, check the external-dns sources", zap.Int("changes", total), zap.Int("max_changes", max))
+		return rejectPlan("max_changes", "%d changes exceed the limit of %d", total, max)
+	}
+	return nil
+}
+
+// checkDomainFilter rejects plans changing records outside the domain filter, which external-dns never
+// plans, so a misbehaving caller of the webhook cannot modify arbitrary records on the controller.
+func (p *Provider) checkDomainFilter(changes *plan.Changes) error {
+	var outside []string
+	for _, action := range []struct {
+		name      string
+		endpoints []*endpoint.Endpoint
+	}{
+		{"create", changes.Create},
+		{"update", changes.UpdateOld},
+		{"update", changes.UpdateNew},
+		{"delete", changes.Delete},
+	} {
+		for _, ep := range action.endpoints {
+			if !p.domainFilter.Match(ep.DNSName) {
+				metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonDomain).Inc()
+				outside = append(outside, fmt.Sprintf("%s %s %s", action.name, ep.RecordType, ep.DNSName))
+			}
+		}
+	}
+	if len(outside) == 0 {
+		return nil
+	}
+
+	log.Error("REFUSING PLAN: changes outside the domain filter", zap.Strings("changes", outside))
+	return rejectPlanDetails("domain_filter", outside, "%d changes outside the domain filter: %s", len(outside), strings.Join(outside, ", "))
+}
+
+// skipDeletes drops every delete from the plan when deletions are disabled, keeping updates.
+func (p *Provider) skipDeletes(changes *plan.Changes) {
+	if !p.config.DisableDeletes || len(changes.Delete) == 0 {
+		return
+	}
+
+	for _, ep := range changes.Delete {
+		log.Debug("skipping delete, deletions are disabled", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+	}
+	metrics.DeletesSkippedTotal.Add(float64(len(changes.Delete)))
+	changes.Delete = nil
+}
@@ -0,0 +1,43 @@
+package unifi
+
+import (
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const testAPIKey = "test-api-key"
+
+// newTestController starts a fake controller accepting the test API key, stopped with the test.
+func newTestController(t *testing.T, opts unifitest.Options) *unifitest.Controller {
+	t.Helper()
+	opts.APIKey = testAPIKey
+	c := unifitest.New(opts)
+	t.Cleanup(c.Close)
+	return c
+}
+
+// newTestConfig returns the configuration parsed from the given environment, pointed at the controller.
+func newTestConfig(t *testing.T, c *unifitest.Controller, external bool, environment map[string]string) *Config {
+	t.Helper()
+	config := &Config{}
+	if err := env.ParseWithOptions(config, env.Options{Environment: environment}); err != nil {
+		t.Fatal(err)
+	}
+	config.Host = c.URL
+	config.APIKey = testAPIKey
+	config.ExternalController = &external
+	return config
+}
+
+// newTestProvider creates a provider without filters connected to the controller.
+func newTestProvider(t *testing.T, c *unifitest.Controller, environment map[string]string) *Provider {
+	t.Helper()
+	p, err := NewUnifiProvider(endpoint.DomainFilter{}, endpoint.TargetNetFilter{}, newTestConfig(t, c, false, environment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*Provider)
+}
@@ -0,0 +1,119 @@
+package unifi
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+)
+
+// recordIndex maps the name, type and value of the controller records to the records,
+// so deletes and updates can resolve record IDs without listing the controller again.
+// Duplicates share a key, so every record of a key is kept.
+type recordIndex struct {
+	sync.RWMutex
+	tenant  string
+	records map[string][]DNSRecord
+	size    int
+	// current is set while the index holds a listing taken during the current plan.
+	current bool
+}
+
+// indexKey returns the normalized index key of a record.
+func indexKey(name, recordType, value string) string {
+	return normalizeName(name) + "/" + recordType + "/" + normalizeTarget(recordType, value)
+}
+
+// listedValue returns the value of a record in the form returned by GetEndpoints,
+// where SRV records carry their priority, weight and port in the value.
+func listedValue(r DNSRecord) string {
+	if r.RecordType == "SRV" && r.Priority != nil && r.Weight != nil && r.Port != nil {
+		return fmt.Sprintf("%d %d %d %s", *r.Priority, *r.Weight, *r.Port, r.Value)
+	}
+	return r.Value
+}
+
+// rebuild replaces the index with the listed records.
+func (i *recordIndex) rebuild(records []DNSRecord) {
+	i.Lock()
+	defer i.Unlock()
+
+	i.records = make(map[string][]DNSRecord, len(records))
+	for _, r := range records {
+		key := indexKey(r.Key, r.RecordType, r.Value)
+		i.records[key] = append(i.records[key], r)
+	}
+	i.size = len(records)
+	i.current = true
+	metrics.RecordIndexSize.WithLabelValues(i.tenant).Set(float64(i.size))
+}
+
+// expire marks the index as listed before the current plan, so the records resolved from it
+// are checked against the controller before the plan modifies them.
+func (i *recordIndex) expire() {
+	i.Lock()
+	defer i.Unlock()
+	i.current = false
+}
+
+// add indexes a record returned by the controller, replacing the entry of the same ID.
+func (i *recordIndex) add(r DNSRecord) {
+	i.Lock()
+	defer i.Unlock()
+
+	if i.records == nil {
+		i.records = map[string][]DNSRecord{}
+	}
+	r.Value = listedValue(r)
+	r.Priority, r.Weight, r.Port = nil, nil, nil
+	key := indexKey(r.Key, r.RecordType, r.Value)
+	i.drop(r.ID, key)
+	i.records[key] = append(i.records[key], r)
+	i.size++
+	metrics.RecordIndexSize.WithLabelValues(i.tenant).Set(float64(i.size))
+}
+
+// remove drops a record from the index.
+func (i *recordIndex) remove(r DNSRecord) {
+	i.Lock()
+	defer i.Unlock()
+
+	i.drop(r.ID, indexKey(r.Key, r.RecordType, listedValue(r)))
+	metrics.RecordIndexSize.WithLabelValues(i.tenant).Set(float64(i.size))
+}
+
+// drop removes the record with the ID from the key. The caller holds the lock.
+func (i *recordIndex) drop(id, key string) {
+	records := i.records[key]
+	n := len(records)
+	records = slices.DeleteFunc(records, func(r DNSRecord) bool { return r.ID == id })
+	i.size -= n - len(records)
+	if len(records) == 0 {
+		delete(i.records, key)
+		return
+	}
+	i.records[key] = records
+}
+
+// lookup returns every indexed record for the targets, duplicates included, and false unless
+// every target is indexed. It also reports whether the index holds a listing taken during the
+// current plan.
+func (i *recordIndex) lookup(name, recordType string, targets []string) ([]DNSRecord, bool, bool) {
+	i.RLock()
+	defer i.RUnlock()
+
+	if i.records == nil {
+		return nil, false, false
+	}
+
+	var records []DNSRecord
+	for _, target := range targets {
+		indexed, ok := i.records[indexKey(name, recordType, target)]
+		if !ok {
+			return nil, false, false
+		}
+		records = append(records, indexed...)
+	}
+	return records, true, i.current
+}
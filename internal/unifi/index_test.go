@@ -0,0 +1,53 @@
+package unifi
+
+import (
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestIndexKeepsDuplicates(t *testing.T) {
+	var index recordIndex
+	index.rebuild([]DNSRecord{
+		{ID: "1", Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+		{ID: "2", Key: "Web.lan", RecordType: "A", Value: "10.0.0.1"},
+		{ID: "3", Key: "web.lan", RecordType: "A", Value: "10.0.0.2"},
+	})
+
+	records, ok, _ := index.lookup("web.lan", "A", []string{"10.0.0.1"})
+	if !ok || len(records) != 2 {
+		t.Fatalf("lookup returned %v, want both duplicates", records)
+	}
+
+	index.remove(records[0])
+	index.add(DNSRecord{ID: "2", Key: "web.lan", RecordType: "A", Value: "10.0.0.1", TTL: 300})
+	records, ok, _ = index.lookup("web.lan", "A", []string{"10.0.0.1"})
+	if !ok || len(records) != 1 || records[0].ID != "2" || records[0].TTL != 300 {
+		t.Errorf("lookup after remove and add returned %v", records)
+	}
+	if index.size != 2 {
+		t.Errorf("index size %d, want 2", index.size)
+	}
+}
+
+func TestDeleteEndpointDeletesDuplicates(t *testing.T) {
+	c := newTestController(t, unifitest.Options{})
+	c.SetRecords("default",
+		unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+		unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+		unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.2"},
+	)
+	p := newTestProvider(t, c, nil)
+
+	// The listing fills the index the delete resolves its records from.
+	if _, err := p.client.GetEndpoints(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.client.DeleteEndpoint(endpoint.NewEndpoint("web.lan", "A", "10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if records := c.Records("default"); len(records) != 1 || records[0].Value != "10.0.0.2" {
+		t.Errorf("records left after delete: %+v", records)
+	}
+}
@@ -0,0 +1,66 @@
+package unifi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+// loadInstanceID resolves the stable identity of this webhook instance.
+// An explicitly configured ID wins, otherwise the ID is read from (or
+// generated into) the configured file so it survives restarts.
+func loadInstanceID(config *Config) (string, error) {
+	if id := strings.TrimSpace(config.InstanceID); id != "" {
+		return id, nil
+	}
+
+	if config.InstanceIDFile == "" {
+		id, err := generateInstanceID()
+		if err != nil {
+			return "", err
+		}
+		log.Warn("no instance id file configured, using an ephemeral instance id", zap.String("instance_id", id))
+		return id, nil
+	}
+
+	data, err := os.ReadFile(config.InstanceIDFile)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read instance id file %s: %w", config.InstanceIDFile, err)
+	}
+
+	id, err := generateInstanceID()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.InstanceIDFile), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create instance id directory: %w", err)
+	}
+	if err := os.WriteFile(config.InstanceIDFile, []byte(id+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write instance id file %s: %w", config.InstanceIDFile, err)
+	}
+
+	log.Info("generated new instance id", zap.String("instance_id", id), zap.String("file", config.InstanceIDFile))
+	return id, nil
+}
+
+// generateInstanceID returns a random 16 byte hex encoded identifier.
+func generateInstanceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate instance id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
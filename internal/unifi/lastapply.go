@@ -0,0 +1,165 @@
+package unifi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// ApplySummary describes the outcome of the most recent ApplyChanges call.
+type ApplySummary struct {
+	StartedAt time.Time      `json:"startedAt"`
+	Duration  string         `json:"duration"`
+	Counts    map[string]int `json:"counts"`
+	Results   []ApplyResult  `json:"results"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// ApplyResult is the outcome of a single endpoint of the plan.
+type ApplyResult struct {
+	Operation string   `json:"operation"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Targets   []string `json:"targets"`
+	Result    string   `json:"result"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// applyReport collects the results of a plan while it is applied.
+// A nil applyReport discards all results.
+type applyReport struct {
+	summary ApplySummary
+	done    map[endpoint.EndpointKey]bool
+}
+
+// newApplyReport starts the report of the plan, counting the requested changes.
+func newApplyReport(changes *plan.Changes) *applyReport {
+	return &applyReport{
+		summary: ApplySummary{
+			StartedAt: time.Now().UTC(),
+			Counts: map[string]int{
+				"create": len(changes.Create),
+				"update": len(changes.UpdateNew),
+				"delete": len(changes.Delete),
+			},
+			Results: []ApplyResult{},
+		},
+		done: map[endpoint.EndpointKey]bool{},
+	}
+}
+
+// add records the outcome of an operation on the endpoint.
+func (r *applyReport) add(operation string, ep *endpoint.Endpoint, err error) {
+	if r == nil {
+		return
+	}
+
+	result := ApplyResult{
+		Operation: operation,
+		Name:      ep.DNSName,
+		Type:      ep.RecordType,
+		Targets:   ep.Targets,
+		Result:    "success",
+	}
+	if err != nil {
+		result.Result = "error"
+		result.Error = err.Error()
+	}
+	r.summary.Results = append(r.summary.Results, result)
+	r.done[ep.Key()] = true
+}
+
+// skip records an endpoint that was deliberately not applied.
+func (r *applyReport) skip(operation string, ep *endpoint.Endpoint, reason string) {
+	if r == nil {
+		return
+	}
+
+	r.summary.Results = append(r.summary.Results, ApplyResult{
+		Operation: operation,
+		Name:      ep.DNSName,
+		Type:      ep.RecordType,
+		Targets:   ep.Targets,
+		Result:    "skipped",
+		Error:     reason,
+	})
+	r.done[ep.Key()] = true
+}
+
+// progress returns the number of operations that succeeded and the number of changes in the plan.
+func (r *applyReport) progress() (applied, total int) {
+	for _, result := range r.summary.Results {
+		if result.Result == "success" {
+			applied++
+		}
+	}
+	for _, count := range r.summary.Counts {
+		total += count
+	}
+	return applied, total
+}
+
+// finish completes the report. Endpoints of the original plan without a result were
+// dropped by a filter, or never attempted when the plan failed or was canceled.
+func (r *applyReport) finish(original *plan.Changes, err error) ApplySummary {
+	result, reason := "skipped", "filtered before apply"
+	if err != nil {
+		result, reason = "not_applied", "plan aborted"
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			reason = "plan canceled"
+		}
+		r.summary.Error = err.Error()
+	}
+
+	for _, group := range []struct {
+		operation string
+		endpoints []*endpoint.Endpoint
+	}{
+		{"delete", original.Delete},
+		{"update", original.UpdateNew},
+		{"create", original.Create},
+	} {
+		for _, ep := range group.endpoints {
+			if r.done[ep.Key()] {
+				continue
+			}
+			r.summary.Results = append(r.summary.Results, ApplyResult{
+				Operation: group.operation,
+				Name:      ep.DNSName,
+				Type:      ep.RecordType,
+				Targets:   ep.Targets,
+				Result:    result,
+				Error:     reason,
+			})
+		}
+	}
+
+	r.summary.Duration = time.Since(r.summary.StartedAt).String()
+	return r.summary
+}
+
+// lastApply holds the summary of the most recent plan.
+type lastApply struct {
+	mu      sync.RWMutex
+	summary *ApplySummary
+}
+
+func (l *lastApply) set(summary ApplySummary) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.summary = &summary
+}
+
+// LastApply returns the summary of the most recent plan, or nil before the first one.
+func (p *Provider) LastApply() any {
+	p.lastApply.mu.RLock()
+	defer p.lastApply.mu.RUnlock()
+	if p.lastApply.summary == nil {
+		return nil
+	}
+	return *p.lastApply.summary
+}
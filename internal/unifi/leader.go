@@ -0,0 +1,19 @@
+package unifi
+
+import "net/http"
+
+// IsLeader reports whether this replica may mutate records on the controller.
+// It is replaced by the leader elector when leader election is enabled.
+var IsLeader = func() bool { return true }
+
+// NotLeaderError is returned for mutations requested from a replica that is not the leader.
+type NotLeaderError struct{}
+
+func (e *NotLeaderError) Error() string {
+	return "not the leader, changes are applied by the leader replica"
+}
+
+// HTTPStatusCode returns the status code the webhook answers changes sent to a follower with.
+func (e *NotLeaderError) HTTPStatusCode() int {
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,53 @@
+package unifi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProviderGaugesByTenant(t *testing.T) {
+	tenants := map[string]int{"site-a": 1, "site-b": 3}
+	for tenant, count := range tenants {
+		c := newTestController(t, unifitest.Options{})
+		var records []unifitest.Record
+		for i := range count {
+			records = append(records, unifitest.Record{Enabled: true, Key: tenant + ".lan", RecordType: "TXT", Value: fmt.Sprintf("record-%d", i)})
+		}
+		c.SetRecords("default", records...)
+
+		config := newTestConfig(t, c, false, nil)
+		config.Tenant = tenant
+		client, err := newUnifiClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetEndpoints(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for tenant, count := range tenants {
+		if got := testutil.ToFloat64(metrics.RecordIndexSize.WithLabelValues(tenant)); got != float64(count) {
+			t.Errorf("record index size of %s = %v, want %d", tenant, got, count)
+		}
+	}
+}
+
+func TestControllerConflictsByTenant(t *testing.T) {
+	detectControllerConflicts("site-a", []DNSRecord{
+		{Key: "web.lan", RecordType: "CNAME", Value: "app.lan"},
+		{Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+	})
+	detectControllerConflicts("site-b", nil)
+
+	if got := testutil.ToFloat64(metrics.ControllerCNAMEConflicts.WithLabelValues("site-a")); got != 1 {
+		t.Errorf("controller conflicts of site-a = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ControllerCNAMEConflicts.WithLabelValues("site-b")); got != 0 {
+		t.Errorf("controller conflicts of site-b = %v, want 0", got)
+	}
+}
@@ -0,0 +1,140 @@
+package unifi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// MockAPI is an in-memory UnifiAPI for exercising providers without a controller.
+type MockAPI struct {
+	mu      sync.Mutex
+	records []DNSRecord
+	nextID  int
+}
+
+var _ recordsClient = (*MockAPI)(nil)
+
+// NewMockAPI returns a MockAPI holding the given records.
+func NewMockAPI(records ...DNSRecord) *MockAPI {
+	return &MockAPI{records: slices.Clone(records)}
+}
+
+// Ready always succeeds.
+func (m *MockAPI) Ready() error {
+	return nil
+}
+
+// Close does nothing.
+func (m *MockAPI) Close() error {
+	return nil
+}
+
+// GetEndpoints returns a copy of the stored records.
+func (m *MockAPI) GetEndpoints() ([]DNSRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.records), nil
+}
+
+// CreateEndpoint stores one record per endpoint target.
+func (m *MockAPI) CreateEndpoint(ep *endpoint.Endpoint) ([]*DNSRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enabled, err := endpointEnabled(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []*DNSRecord
+	for _, target := range ep.Targets {
+		m.nextID++
+		record := DNSRecord{
+			ID:         strconv.Itoa(m.nextID),
+			Enabled:    enabled,
+			Key:        ep.DNSName,
+			RecordType: ep.RecordType,
+			TTL:        ep.RecordTTL,
+			Value:      target,
+		}
+		m.records = append(m.records, record)
+		created = append(created, &record)
+	}
+	return created, nil
+}
+
+// UpdateEndpoint replaces the records of the old endpoint by the targets of the new one.
+func (m *MockAPI) UpdateEndpoint(_ context.Context, old, new *endpoint.Endpoint) error {
+	if err := m.DeleteEndpoint(old); err != nil {
+		return err
+	}
+	_, err := m.CreateEndpoint(new)
+	return err
+}
+
+// DeleteEndpoint removes the records matching the endpoint's targets.
+func (m *MockAPI) DeleteEndpoint(ep *endpoint.Endpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.records)
+	m.records = slices.DeleteFunc(m.records, func(r DNSRecord) bool {
+		return normalizeName(r.Key) == normalizeName(ep.DNSName) &&
+			r.RecordType == ep.RecordType &&
+			slices.ContainsFunc(ep.Targets, func(target string) bool {
+				return normalizeTarget(r.RecordType, r.Value) == normalizeTarget(ep.RecordType, target)
+			})
+	})
+	if len(m.records) == n {
+		return fmt.Errorf("record not found: %s", ep.DNSName)
+	}
+	return nil
+}
+
+// RawRecords returns the stored records encoded as JSON.
+func (m *MockAPI) RawRecords(context.Context) ([]byte, error) {
+	records, _ := m.GetEndpoints()
+	return json.Marshal(records)
+}
+
+// deleteRecord removes the record with the ID of the given record.
+func (m *MockAPI) deleteRecord(record DNSRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = slices.DeleteFunc(m.records, func(r DNSRecord) bool { return r.ID == record.ID })
+	return nil
+}
+
+// readTTL returns the TTL as stored, the mock has no default TTL.
+func (m *MockAPI) readTTL(ttl endpoint.TTL) endpoint.TTL {
+	return ttl
+}
+
+// expireIndex does nothing, the mock keeps no record index.
+func (m *MockAPI) expireIndex() {}
+
+// site returns no site, the mock keeps the records of a single one.
+func (m *MockAPI) site() string {
+	return ""
+}
+
+// controllerStatus reports a connected in-memory controller.
+func (m *MockAPI) controllerStatus() ControllerStatus {
+	return ControllerStatus{Host: "mock", Connected: true}
+}
+
+// sessionStatus reports no session, the mock needs no authentication.
+func (m *MockAPI) sessionStatus() (string, *SessionStatus) {
+	return "none", nil
+}
+
+// loginFailures always returns zero.
+func (m *MockAPI) loginFailures() int {
+	return 0
+}
@@ -0,0 +1,79 @@
+package unifi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// newMockProvider creates a provider without filters managing the records of api.
+func newMockProvider(t *testing.T, api *MockAPI) *Provider {
+	t.Helper()
+	config := &Config{}
+	if err := env.ParseWithOptions(config, env.Options{Environment: map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewUnifiProviderWithAPI(endpoint.DomainFilter{}, endpoint.TargetNetFilter{}, config, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*Provider)
+}
+
+func TestProviderWithMockAPI(t *testing.T) {
+	api := NewMockAPI(DNSRecord{ID: "1", Enabled: true, Key: "old.lan", RecordType: "A", Value: "10.0.0.1"})
+	p := newMockProvider(t, api)
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.lan", "A", "10.0.0.2")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("old.lan", "A", "10.0.0.1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].DNSName != "new.lan" || endpoints[0].Targets[0] != "10.0.0.2" {
+		t.Errorf("Records() = %v, want only new.lan", endpoints)
+	}
+
+	status := p.Status().(Status)
+	if !status.Controller.Connected || status.Session != nil {
+		t.Errorf("status controller %+v, session %+v, want a connected controller without session", status.Controller, status.Session)
+	}
+	if err := p.Degraded(); err != nil {
+		t.Errorf("Degraded() = %v, want nil", err)
+	}
+}
+
+func TestPruneDuplicatesWithMockAPI(t *testing.T) {
+	api := NewMockAPI(
+		DNSRecord{ID: "1", Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+		DNSRecord{ID: "2", Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"},
+	)
+	p := newMockProvider(t, api)
+	p.config.PruneDuplicates = true
+
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := api.GetEndpoints(); len(records) != 1 {
+		t.Errorf("kept %d records, want the duplicate pruned", len(records))
+	}
+}
+
+func TestNewUnifiProviderWithAPIRejectsForeignAPI(t *testing.T) {
+	config := &Config{}
+	if _, err := NewUnifiProviderWithAPI(endpoint.DomainFilter{}, endpoint.TargetNetFilter{}, config, foreignAPI{}); err == nil {
+		t.Error("NewUnifiProviderWithAPI() accepted an api without the provider methods")
+	}
+}
+
+// foreignAPI implements only the exported operations of UnifiAPI.
+type foreignAPI struct{ UnifiAPI }
@@ -0,0 +1,66 @@
+package unifi
+
+import (
+	"net/netip"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// normalizeName lowercases a DNS name and strips its trailing dot.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// normalizeTarget canonicalizes a target value for the record type, so the form stored by the
+// controller and the form desired by external-dns compare equal.
+func normalizeTarget(recordType, target string) string {
+	target = trimTargetDot(recordType, target)
+	switch recordType {
+	case "A", "AAAA":
+		if addr, err := netip.ParseAddr(target); err == nil {
+			return addr.String()
+		}
+		return target
+	case "CNAME", "NS":
+		return strings.ToLower(target)
+	case "SRV":
+		fields := strings.Fields(target)
+		if len(fields) != 4 {
+			return target
+		}
+		fields[3] = strings.ToLower(fields[3])
+		return strings.Join(fields, " ")
+	default:
+		return target
+	}
+}
+
+// trimTargetDot removes the trailing dot of the host name held by a target. The controller stores
+// targets verbatim, so fully qualified targets would otherwise never match their desired form.
+// It is the part of normalizeTarget applied to the values written to the controller.
+func trimTargetDot(recordType, target string) string {
+	switch recordType {
+	case "CNAME", "NS", "SRV":
+		return strings.TrimSuffix(target, ".")
+	default:
+		return target
+	}
+}
+
+// normalizeEndpoint canonicalizes the name and targets of the endpoint in place.
+func normalizeEndpoint(ep *endpoint.Endpoint) {
+	ep.DNSName = normalizeName(ep.DNSName)
+
+	seen := map[string]bool{}
+	targets := make(endpoint.Targets, 0, len(ep.Targets))
+	for _, target := range ep.Targets {
+		target = normalizeTarget(ep.RecordType, target)
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	ep.Targets = targets
+}
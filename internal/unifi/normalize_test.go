@@ -0,0 +1,26 @@
+package unifi
+
+import "testing"
+
+func TestNormalizeTarget(t *testing.T) {
+	tests := []struct {
+		recordType, target, want string
+	}{
+		{"A", "10.0.0.1", "10.0.0.1"},
+		{"AAAA", "2001:DB8:0:0::1", "2001:db8::1"},
+		{"CNAME", "App.Example.com.", "app.example.com"},
+		{"NS", "ns1.example.com.", "ns1.example.com"},
+		{"SRV", "10 5 443 Host.Example.com.", "10 5 443 host.example.com"},
+		{"SRV", "host.example.com.", "host.example.com"},
+		{"TXT", "value.", "value."},
+	}
+	for _, tt := range tests {
+		if got := normalizeTarget(tt.recordType, tt.target); got != tt.want {
+			t.Errorf("normalizeTarget(%q, %q) = %q, want %q", tt.recordType, tt.target, got, tt.want)
+		}
+		// Values written with their trailing dot trimmed must compare equal to the desired target.
+		if got := normalizeTarget(tt.recordType, trimTargetDot(tt.recordType, tt.target)); got != tt.want {
+			t.Errorf("normalizeTarget of the trimmed %s target %q = %q, want %q", tt.recordType, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package unifi
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// ownershipHeritage identifies marker records written by the webhook.
+const ownershipHeritage = "heritage=external-dns-unifi-webhook"
+
+// ownerValue returns the value of the marker records owned by this instance.
+func (p *Provider) ownerValue() string {
+	return ownershipHeritage + ",owner=" + p.instanceID
+}
+
+// markerName returns the name of the marker record for a DNS name.
+func (p *Provider) markerName(name string) string {
+	return p.config.OwnershipPrefix + name
+}
+
+// isMarker reports whether the record is an ownership marker.
+func (p *Provider) isMarker(r DNSRecord) bool {
+	return r.RecordType == "TXT" && strings.HasPrefix(strings.ToLower(r.Key), strings.ToLower(p.config.OwnershipPrefix))
+}
+
+// ownedNames returns the normalized names carrying a marker record owned by this instance.
+func (p *Provider) ownedNames(records []DNSRecord) map[string]bool {
+	owned := map[string]bool{}
+	for _, r := range records {
+		if p.isMarker(r) && r.Value == p.ownerValue() {
+			owned[normalizeName(r.Key[len(p.config.OwnershipPrefix):])] = true
+		}
+	}
+	return owned
+}
+
+// filterUnowned drops changes that would modify records this instance does not own.
+// Creates are only refused when the name already holds records created by someone else.
+func (p *Provider) filterUnowned(changes *plan.Changes, records []DNSRecord, owned map[string]bool) {
+	foreign := map[string]bool{}
+	for _, r := range records {
+		if name := normalizeName(r.Key); !p.isMarker(r) && !owned[name] {
+			foreign[name] = true
+		}
+	}
+
+	keep := func(action string, endpoints []*endpoint.Endpoint, skip map[string]bool) []*endpoint.Endpoint {
+		var kept []*endpoint.Endpoint
+		for _, ep := range endpoints {
+			if skip[normalizeName(ep.DNSName)] {
+				log.Warn("refusing to modify record not owned by this instance", zap.String("action", action), zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+				continue
+			}
+			kept = append(kept, ep)
+		}
+		return kept
+	}
+
+	unowned := map[string]bool{}
+	for _, ep := range append(changes.UpdateOld, changes.Delete...) {
+		if name := normalizeName(ep.DNSName); !owned[name] {
+			unowned[name] = true
+		}
+	}
+
+	changes.Create = keep("create", changes.Create, foreign)
+	changes.UpdateOld = keep("update", changes.UpdateOld, unowned)
+	changes.UpdateNew = keep("update", changes.UpdateNew, unowned)
+	changes.Delete = keep("delete", changes.Delete, unowned)
+}
+
+// claim creates the marker record for a name unless this instance already owns it.
+func (p *Provider) claim(name string, owned map[string]bool) error {
+	if owned[normalizeName(name)] {
+		return nil
+	}
+
+	if _, err := p.client.CreateEndpoint(endpoint.NewEndpoint(p.markerName(name), "TXT", p.ownerValue())); err != nil {
+		return err
+	}
+	owned[normalizeName(name)] = true
+	return nil
+}
+
+// pruneMarkers deletes the marker records of owned names that no longer hold any records.
+// The records left on the controller follow from the listing taken before the plan and the
+// changes applied since, so the controller is not listed again.
+func (p *Provider) pruneMarkers(records []DNSRecord, changes *plan.Changes, owned map[string]bool) error {
+	state := recordState{}
+	for _, r := range records {
+		if !p.isMarker(r) {
+			state.add(r.Key, r.RecordType, 1)
+		}
+	}
+	for _, ep := range slices.Concat(changes.Delete, changes.UpdateOld) {
+		state.add(ep.DNSName, ep.RecordType, -len(ep.Targets))
+	}
+	for _, ep := range slices.Concat(changes.Create, changes.UpdateNew) {
+		state.add(ep.DNSName, ep.RecordType, len(ep.Targets))
+	}
+
+	for name := range owned {
+		if state.used(name) {
+			continue
+		}
+
+		log.Debug("deleting ownership marker", zap.String("name", name))
+		if err := p.client.DeleteEndpoint(endpoint.NewEndpoint(p.markerName(name), "TXT", p.ownerValue())); err != nil {
+			return err
+		}
+		delete(owned, name)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package unifi
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestOwnershipRequiresStableInstanceID(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "ephemeral id", env: map[string]string{"UNIFI_OWNERSHIP": "true"}, wantErr: true},
+		{name: "blank id", env: map[string]string{"UNIFI_OWNERSHIP": "true", "UNIFI_INSTANCE_ID": " "}, wantErr: true},
+		{name: "configured id", env: map[string]string{"UNIFI_OWNERSHIP": "true", "UNIFI_INSTANCE_ID": "webhook-1"}},
+		{name: "id file", env: map[string]string{"UNIFI_OWNERSHIP": "true", "UNIFI_INSTANCE_ID_FILE": filepath.Join(t.TempDir(), "instance-id")}},
+		{name: "ownership disabled", env: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			_, err := NewUnifiProvider(endpoint.DomainFilter{}, endpoint.TargetNetFilter{}, newTestConfig(t, c, false, tt.env))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewUnifiProvider() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPruneMarkers(t *testing.T) {
+	const owner = ownershipHeritage + ",owner=webhook-1"
+
+	c := newTestController(t, unifitest.Options{})
+	c.SetRecords("default",
+		unifitest.Record{Enabled: true, Key: "_unifi-webhook.old.lan", RecordType: "TXT", Value: owner},
+		unifitest.Record{Enabled: true, Key: "old.lan", RecordType: "A", Value: "10.0.0.1"},
+		unifitest.Record{Enabled: true, Key: "_unifi-webhook.kept.lan", RecordType: "TXT", Value: owner},
+		unifitest.Record{Enabled: true, Key: "kept.lan", RecordType: "A", Value: "10.0.0.2"},
+		unifitest.Record{Enabled: true, Key: "kept.lan", RecordType: "AAAA", Value: "fd00::2"},
+	)
+	p := newTestProvider(t, c, map[string]string{"UNIFI_OWNERSHIP": "true", "UNIFI_INSTANCE_ID": "webhook-1"})
+
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.lan", "A", "10.0.0.3")},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("old.lan", "A", "10.0.0.1"),
+			endpoint.NewEndpoint("kept.lan", "AAAA", "fd00::2"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]bool{}
+	for _, r := range c.Records("default") {
+		keys[r.Key] = true
+	}
+	for key, want := range map[string]bool{
+		"_unifi-webhook.old.lan":  false,
+		"old.lan":                 false,
+		"_unifi-webhook.kept.lan": true,
+		"kept.lan":                true,
+		"_unifi-webhook.new.lan":  true,
+		"new.lan":                 true,
+	} {
+		if keys[key] != want {
+			t.Errorf("record %s present %t, want %t", key, keys[key], want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package unifi
+
+import (
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// plannedChange is a change of the plan, e.g. creating the A record foo.lan targeting 10.0.0.5.
+type plannedChange struct {
+	Operation string
+	Type      string
+	Name      string
+	Targets   []string
+	// PreviousTargets are the targets replaced by an update, when the plan holds them.
+	PreviousTargets []string
+}
+
+// planDiff returns the changes of the plan, deletes first, then updates and creates.
+func planDiff(changes *plan.Changes) []plannedChange {
+	var diff []plannedChange
+	for _, ep := range changes.Delete {
+		diff = append(diff, plannedChange{Operation: "DELETE", Type: ep.RecordType, Name: ep.DNSName})
+	}
+
+	olds := map[endpoint.EndpointKey]*endpoint.Endpoint{}
+	for _, ep := range changes.UpdateOld {
+		olds[ep.Key()] = ep
+	}
+	for _, ep := range changes.UpdateNew {
+		change := plannedChange{Operation: "UPDATE", Type: ep.RecordType, Name: ep.DNSName, Targets: ep.Targets}
+		if old, ok := olds[ep.Key()]; ok {
+			change.PreviousTargets = old.Targets
+		}
+		diff = append(diff, change)
+	}
+
+	for _, ep := range changes.Create {
+		diff = append(diff, plannedChange{Operation: "CREATE", Type: ep.RecordType, Name: ep.DNSName, Targets: ep.Targets})
+	}
+	return diff
+}
+
+// logPlan logs the changes about to be applied, with the full endpoints at debug level.
+func logPlan(changes *plan.Changes) {
+	diff := planDiff(changes)
+	if len(diff) == 0 {
+		log.Debug("applying plan without changes")
+		return
+	}
+
+	for _, change := range diff {
+		fields := []zap.Field{
+			zap.String("operation", change.Operation),
+			zap.String("type", change.Type),
+			zap.String("name", change.Name),
+			zap.Strings("targets", change.Targets),
+		}
+		if change.PreviousTargets != nil {
+			fields = append(fields, zap.Strings("previous_targets", change.PreviousTargets))
+		}
+		log.Info("planned change", fields...)
+	}
+	log.Debug("plan details",
+		zap.Any("create", changes.Create),
+		zap.Any("update_old", changes.UpdateOld),
+		zap.Any("update_new", changes.UpdateNew),
+		zap.Any("delete", changes.Delete),
+	)
+}
@@ -0,0 +1,39 @@
+package unifi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestLogPlanFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log.SetLogger(zap.New(core))
+	t.Cleanup(func() { log.SetLogger(zap.NewNop()) })
+
+	logPlan(&plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("new.example.com", "A", "10.0.0.5")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("app.example.com", "A", "10.0.0.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("app.example.com", "A", "10.0.0.2", "10.0.0.3")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("old.example.com", "CNAME", "app.example.com")},
+	})
+
+	want := []map[string]any{
+		{"operation": "DELETE", "type": "CNAME", "name": "old.example.com", "targets": []any{}},
+		{"operation": "UPDATE", "type": "A", "name": "app.example.com", "targets": []any{"10.0.0.2", "10.0.0.3"}, "previous_targets": []any{"10.0.0.1"}},
+		{"operation": "CREATE", "type": "A", "name": "new.example.com", "targets": []any{"10.0.0.5"}},
+	}
+	var got []map[string]any
+	for _, entry := range logs.FilterMessage("planned change").AllUntimed() {
+		got = append(got, entry.ContextMap())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logged planned changes\n%v\nwant\n%v", got, want)
+	}
+}
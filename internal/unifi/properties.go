@@ -0,0 +1,76 @@
+package unifi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// providerSpecificEnabled controls whether a record is created enabled on the controller.
+	// It is set through the external-dns.alpha.kubernetes.io/webhook-unifi-enabled annotation.
+	providerSpecificEnabled = "webhook/unifi-enabled"
+	// providerSpecificTTL overrides the TTL of the record in seconds.
+	// It is set through the external-dns.alpha.kubernetes.io/webhook-unifi-ttl annotation.
+	providerSpecificTTL = "webhook/unifi-ttl"
+)
+
+// endpointEnabled returns whether the record for the endpoint should be enabled, defaulting to true.
+func endpointEnabled(ep *endpoint.Endpoint) (bool, error) {
+	value, ok := ep.GetProviderSpecificProperty(providerSpecificEnabled)
+	if !ok {
+		return true, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q for %s: %w", providerSpecificEnabled, value, ep.DNSName, err)
+	}
+	return enabled, nil
+}
+
+// endpointTTL returns the TTL of the record for the endpoint, honoring the TTL override property.
+func endpointTTL(ep *endpoint.Endpoint) (endpoint.TTL, error) {
+	value, ok := ep.GetProviderSpecificProperty(providerSpecificTTL)
+	if !ok {
+		return ep.RecordTTL, nil
+	}
+
+	ttl, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid %s value %q for %s: must be a non-negative number of seconds", providerSpecificTTL, value, ep.DNSName)
+	}
+	return endpoint.TTL(ttl), nil
+}
+
+// adjustProviderSpecific canonicalizes the provider specific properties of the endpoint, so they
+// compare equal to the ones reported by Records. Enabled records carry no property at all.
+func adjustProviderSpecific(ep *endpoint.Endpoint) {
+	// The TTL override is folded into the record TTL, which is what Records reports.
+	if _, ok := ep.GetProviderSpecificProperty(providerSpecificTTL); ok {
+		ttl, err := endpointTTL(ep)
+		if err != nil {
+			log.Warn("ignoring invalid provider specific property", zap.String("name", ep.DNSName), zap.Error(err))
+		} else {
+			ep.RecordTTL = ttl
+		}
+		ep.DeleteProviderSpecificProperty(providerSpecificTTL)
+	}
+
+	if _, ok := ep.GetProviderSpecificProperty(providerSpecificEnabled); !ok {
+		return
+	}
+
+	enabled, err := endpointEnabled(ep)
+	if err != nil {
+		log.Warn("ignoring invalid provider specific property", zap.String("name", ep.DNSName), zap.Error(err))
+	}
+	if err != nil || enabled {
+		ep.DeleteProviderSpecificProperty(providerSpecificEnabled)
+		return
+	}
+	ep.SetProviderSpecificProperty(providerSpecificEnabled, "false")
+}
@@ -0,0 +1,66 @@
+package unifi
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// protectedRecords holds exact names or glob patterns of records the provider never modifies.
+type protectedRecords []string
+
+// newProtectedRecords validates and normalizes the configured patterns.
+func newProtectedRecords(patterns []string) (protectedRecords, error) {
+	var p protectedRecords
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "."))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid protected record pattern %q: %w", pattern, err)
+		}
+		p = append(p, pattern)
+	}
+	return p, nil
+}
+
+// Match reports whether the name is protected.
+func (p protectedRecords) Match(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, pattern := range p {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter drops every change that touches a protected record.
+func (p protectedRecords) filter(changes *plan.Changes) {
+	if len(p) == 0 {
+		return
+	}
+
+	keep := func(action string, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+		var kept []*endpoint.Endpoint
+		for _, ep := range endpoints {
+			if p.Match(ep.DNSName) {
+				log.Warn("refusing to modify protected record", zap.String("action", action), zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+				continue
+			}
+			kept = append(kept, ep)
+		}
+		return kept
+	}
+
+	changes.Create = keep("create", changes.Create)
+	changes.UpdateOld = keep("update", changes.UpdateOld)
+	changes.UpdateNew = keep("update", changes.UpdateNew)
+	changes.Delete = keep("delete", changes.Delete)
+}
@@ -2,9 +2,14 @@ package unifi
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
 	"go.uber.org/zap"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
@@ -15,21 +20,133 @@ import (
 type Provider struct {
 	provider.BaseProvider
 
-	client       *httpClient
+	client       recordsClient
+	config       *Config
+	protected    protectedRecords
 	domainFilter endpoint.DomainFilter
+	targetFilter endpoint.TargetNetFilter
+	recordTypes  recordTypes
+	targetRegex  *regexp.Regexp
+	instanceID   string
+	state        runtimeState
+
+	// applyMu serializes applying plans with the background reconcile.
+	applyMu sync.Mutex
+	applied appliedRecords
+
+	lastApply lastApply
+}
+
+// recordsClient is the client a provider manages records with. Besides the operations of UnifiAPI,
+// it reports the controller state the provider serves in its status and readiness.
+type recordsClient interface {
+	UnifiAPI
+	RawRecords(ctx context.Context) ([]byte, error)
+	deleteRecord(record DNSRecord) error
+	readTTL(ttl endpoint.TTL) endpoint.TTL
+	expireIndex()
+	site() string
+	controllerStatus() ControllerStatus
+	sessionStatus() (authMode string, session *SessionStatus)
+	loginFailures() int
 }
 
 // NewUnifiProvider initializes a new DNSProvider.
-func NewUnifiProvider(domainFilter endpoint.DomainFilter, config *Config) (provider.Provider, error) {
-	c, err := newUnifiClient(config)
+func NewUnifiProvider(domainFilter endpoint.DomainFilter, targetFilter endpoint.TargetNetFilter, config *Config) (provider.Provider, error) {
+	return newProvider(domainFilter, targetFilter, config, nil)
+}
+
+// NewUnifiProviderWithAPI initializes a new DNSProvider managing the records through api instead of
+// a client of the configured controller. api must be a client of this package, such as MockAPI.
+func NewUnifiProviderWithAPI(domainFilter endpoint.DomainFilter, targetFilter endpoint.TargetNetFilter, config *Config, api UnifiAPI) (provider.Provider, error) {
+	client, ok := api.(recordsClient)
+	if !ok {
+		return nil, fmt.Errorf("unsupported unifi api: %T", api)
+	}
+	return newProvider(domainFilter, targetFilter, config, client)
+}
+
+// newProvider initializes a provider with the client, or with a client of the configured controller when nil.
+func newProvider(domainFilter endpoint.DomainFilter, targetFilter endpoint.TargetNetFilter, config *Config, client recordsClient) (provider.Provider, error) {
+	switch config.CNAMEConflictPolicy {
+	case CNAMEConflictPolicyReject, CNAMEConflictPolicyRepair, CNAMEConflictPolicyIgnore:
+	default:
+		return nil, fmt.Errorf("unknown cname conflict policy: %s", config.CNAMEConflictPolicy)
+	}
+	if err := validateIPv6Policy(config.IPv6Policy); err != nil {
+		return nil, err
+	}
+	domainFilter, err := negotiableDomainFilter(domainFilter)
+	if err != nil {
+		return nil, err
+	}
+	typeTTLs := make(map[string]int64, len(config.TypeTTLs))
+	for recordType, ttl := range config.TypeTTLs {
+		if ttl < 0 {
+			return nil, fmt.Errorf("invalid UNIFI_TYPE_TTLS: negative ttl for %s", recordType)
+		}
+		typeTTLs[strings.ToUpper(recordType)] = ttl
+	}
+	config.TypeTTLs = typeTTLs
+	if config.CircuitBreakerThreshold > 0 && config.CircuitBreakerCooldown <= 0 {
+		return nil, fmt.Errorf("invalid UNIFI_CIRCUIT_BREAKER_COOLDOWN: must be positive while the circuit breaker is enabled")
+	}
 
+	var targetRegex *regexp.Regexp
+	if config.ExcludeTargetRegex != "" {
+		re, err := regexp.Compile(config.ExcludeTargetRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target exclusion regex: %w", err)
+		}
+		targetRegex = re
+	}
+
+	if config.Ownership && strings.TrimSpace(config.InstanceID) == "" && config.InstanceIDFile == "" {
+		return nil, fmt.Errorf("UNIFI_OWNERSHIP requires a stable instance id: set UNIFI_INSTANCE_ID or UNIFI_INSTANCE_ID_FILE")
+	}
+	instanceID, err := loadInstanceID(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create the unifi client: %w", err)
+		return nil, fmt.Errorf("failed to load the instance id: %w", err)
+	}
+	log.Info("using instance id", zap.String("instance_id", instanceID))
+	metrics.InstanceInfo.WithLabelValues(instanceID).Set(1)
+
+	protected, err := newProtectedRecords(config.ProtectedRecords)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		c, err := newUnifiClient(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the unifi client: %w", err)
+		}
+		client = c
+	}
+
+	// The snapshot is matched against the normalized host and the resolved site of the client.
+	snapshot, err := loadSnapshot(config, client.site())
+	if err != nil {
+		log.Warn("starting without a record snapshot", zap.Error(err))
 	}
 
 	p := &Provider{
-		client:       c,
+		client:       client,
+		config:       config,
+		protected:    protected,
 		domainFilter: domainFilter,
+		targetFilter: targetFilter,
+		recordTypes:  newRecordTypes(config.RecordTypes),
+		targetRegex:  targetRegex,
+		instanceID:   instanceID,
+		state:        runtimeState{tenant: config.Tenant},
+	}
+	if snapshot != nil {
+		p.state.fallback, p.state.warm = snapshot, true
+	}
+
+	if config.ReconcileInterval > 0 {
+		go p.reconcileLoop(config.ReconcileInterval)
 	}
 
 	return p, nil
@@ -37,24 +154,62 @@ func NewUnifiProvider(domainFilter endpoint.DomainFilter, config *Config) (provi
 
 // Records returns the list of records in the DNS provider.
 func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
-	records, err := p.client.GetEndpoints()
+	records, stale, err := p.listRecords()
 	if err != nil {
 		return nil, err
 	}
+	_, duplicates := findDuplicates(records)
+	metrics.DuplicateRecords.WithLabelValues(p.config.Tenant).Set(float64(len(duplicates)))
+	if p.config.PruneDuplicates && IsLeader() && !stale {
+		if records, err = p.pruneDuplicates(records); err != nil {
+			p.state.failure(err)
+			return nil, err
+		}
+	}
+	if !stale {
+		p.state.success(records)
+	}
+	detectControllerConflicts(p.config.Tenant, records)
 
+	var owned map[string]bool
+	if p.config.Ownership {
+		owned = p.ownedNames(records)
+	}
+
+	// Records sharing a name and type are merged into a single endpoint with multiple targets.
 	var endpoints []*endpoint.Endpoint
+	merged := map[endpoint.EndpointKey]*endpoint.Endpoint{}
 	for _, record := range records {
+		if p.config.Ownership && (p.isMarker(record) || !owned[normalizeName(record.Key)]) {
+			continue
+		}
+		if !p.recordTypes.Allowed(record.RecordType) {
+			metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonRecordType).Inc()
+			continue
+		}
+
 		ep := &endpoint.Endpoint{
 			DNSName:    record.Key,
 			RecordType: record.RecordType,
-			RecordTTL:  record.TTL,
+			RecordTTL:  p.client.readTTL(record.TTL),
 			Targets:    endpoint.NewTargets(record.Value),
 		}
+		if !record.Enabled {
+			ep.SetProviderSpecificProperty(providerSpecificEnabled, "false")
+		}
+		normalizeEndpoint(ep)
 
 		if !p.domainFilter.Match(ep.DNSName) {
+			metrics.FilteredEndpointsTotal.WithLabelValues(filterReasonDomain).Inc()
 			continue
 		}
 
+		key := endpoint.EndpointKey{DNSName: ep.DNSName, RecordType: ep.RecordType}
+		if existing, ok := merged[key]; ok {
+			existing.Targets = append(existing.Targets, ep.Targets...)
+			continue
+		}
+		merged[key] = ep
 		endpoints = append(endpoints, ep)
 	}
 
@@ -63,27 +218,289 @@ func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 
 // ApplyChanges applies a given set of changes in the DNS provider.
 func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
-	for _, endpoint := range append(changes.UpdateOld, changes.Delete...) {
+	if !IsLeader() {
+		return &NotLeaderError{}
+	}
+
+	metrics.LastPlanChanges.WithLabelValues(p.config.Tenant, "create").Set(float64(len(changes.Create)))
+	metrics.LastPlanChanges.WithLabelValues(p.config.Tenant, "update").Set(float64(len(changes.UpdateNew)))
+	metrics.LastPlanChanges.WithLabelValues(p.config.Tenant, "delete").Set(float64(len(changes.Delete)))
+	defer metrics.LastPlanTimestamp.WithLabelValues(p.config.Tenant).SetToCurrentTime()
+
+	original := &plan.Changes{
+		Create:    append([]*endpoint.Endpoint(nil), changes.Create...),
+		UpdateOld: append([]*endpoint.Endpoint(nil), changes.UpdateOld...),
+		UpdateNew: append([]*endpoint.Endpoint(nil), changes.UpdateNew...),
+		Delete:    append([]*endpoint.Endpoint(nil), changes.Delete...),
+	}
+	report := newApplyReport(original)
+
+	err := p.applyChanges(ctx, changes, report)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		applied, total := report.progress()
+		log.Warn("plan canceled, stopped between records", zap.Int("applied", applied), zap.Int("total", total), zap.Error(err))
+		metrics.PlansCanceledTotal.Inc()
+		metrics.CanceledPlanChangesTotal.WithLabelValues("applied").Add(float64(applied))
+		metrics.CanceledPlanChangesTotal.WithLabelValues("not_applied").Add(float64(total - applied))
+	}
+	p.lastApply.set(report.finish(original, err))
+	if err != nil {
+		metrics.LastPlanSuccess.WithLabelValues(p.config.Tenant).Set(0)
+		p.state.failure(err)
+		return err
+	}
+	metrics.LastPlanSuccess.WithLabelValues(p.config.Tenant).Set(1)
+	p.state.success(nil)
+	return nil
+}
+
+// applyChanges deletes the old records before creating the new ones.
+func (p *Provider) applyChanges(ctx context.Context, changes *plan.Changes, report *applyReport) (err error) {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+
+	// Records resolved from an earlier listing are checked against the controller once per plan.
+	p.client.expireIndex()
+
+	var created []createdRecords
+	defer func() {
+		if err != nil && len(created) > 0 && p.config.RollbackOnFailure {
+			log.Warn("plan failed, rolling back the created records", zap.Int("endpoints", len(created)), zap.Error(err))
+			p.rollback(created, report)
+		}
+	}()
+
+	if err := p.checkDomainFilter(changes); err != nil {
+		return err
+	}
+	if err := p.checkMaxChanges(changes); err != nil {
+		return err
+	}
+	if err := p.validateChanges(changes); err != nil {
+		return err
+	}
+
+	// Deletes are skipped first, so the conflict check sees the records that are actually left.
+	p.skipDeletes(changes)
+	deletes := len(changes.Delete)
+	if err := p.validateCNAMEConflicts(changes); err != nil {
+		log.Error("rejecting plan", zap.Error(err))
+		return err
+	}
+	// Repairing conflicts adds deletes, which count against the limits like the planned ones.
+	if len(changes.Delete) > deletes {
+		if err := p.checkMaxChanges(changes); err != nil {
+			return err
+		}
+	}
+	p.recordTypes.filterChanges(changes)
+	p.protected.filter(changes)
+
+	var listed []DNSRecord
+	var owned map[string]bool
+	if p.config.Ownership {
+		records, err := p.client.GetEndpoints()
+		if err != nil {
+			return err
+		}
+		listed = records
+		owned = p.ownedNames(records)
+		p.filterUnowned(changes, records, owned)
+	}
+
+	logPlan(changes)
+	for _, endpoint := range changes.Delete {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		log.Debug("deleting endpoint", zap.String("name", endpoint.DNSName), zap.String("type", endpoint.RecordType))
 
-		if err := p.client.DeleteEndpoint(endpoint); err != nil {
+		err := p.client.DeleteEndpoint(endpoint)
+		report.add("delete", endpoint, err)
+		if err != nil {
 			log.Error("failed to delete endpoint", zap.String("name", endpoint.DNSName), zap.String("type", endpoint.RecordType), zap.Error(err))
 			return err
 		}
+		p.applied.forget(endpoint)
+		countChange("delete", endpoint)
+	}
+
+	creates, err := p.applyUpdates(ctx, changes, report)
+	if err != nil {
+		return err
 	}
 
-	for _, endpoint := range append(changes.Create, changes.UpdateNew...) {
+	for _, endpoint := range append(changes.Create, creates...) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if isWildcard(endpoint.DNSName) {
+			skipWildcard(endpoint)
+			report.skip("create", endpoint, "wildcard records are not supported")
+			continue
+		}
 		log.Debug("creating endpoint", zap.String("name", endpoint.DNSName), zap.String("type", endpoint.RecordType))
 
-		if _, err := p.client.CreateEndpoint(endpoint); err != nil {
+		if p.config.Ownership {
+			if err := p.claim(endpoint.DNSName, owned); err != nil {
+				log.Error("failed to create ownership marker", zap.String("name", endpoint.DNSName), zap.Error(err))
+				report.add("create", endpoint, err)
+				return err
+			}
+		}
+
+		records, err := p.client.CreateEndpoint(endpoint)
+		if len(records) > 0 {
+			created = append(created, createdRecords{endpoint: endpoint, records: records})
+		}
+		report.add("create", endpoint, err)
+		if err != nil {
 			log.Error("failed to create endpoint", zap.String("name", endpoint.DNSName), zap.String("type", endpoint.RecordType), zap.Error(err))
 			return err
 		}
+		p.applied.remember(endpoint)
+		countChange("create", endpoint)
+	}
+
+	if p.config.Ownership {
+		if err := p.pruneMarkers(listed, changes, owned); err != nil {
+			log.Error("failed to prune ownership markers", zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyUpdates updates the records of every UpdateOld/UpdateNew pair in place.
+// Updates without a matching old endpoint are returned to be created instead,
+// and old endpoints without a new one are deleted.
+func (p *Provider) applyUpdates(ctx context.Context, changes *plan.Changes, report *applyReport) ([]*endpoint.Endpoint, error) {
+	olds := map[endpoint.EndpointKey]*endpoint.Endpoint{}
+	for _, ep := range changes.UpdateOld {
+		olds[ep.Key()] = ep
+	}
+
+	var creates []*endpoint.Endpoint
+	for _, ep := range changes.UpdateNew {
+		old, ok := olds[ep.Key()]
+		if !ok || isWildcard(ep.DNSName) {
+			creates = append(creates, ep)
+			continue
+		}
+		delete(olds, ep.Key())
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// A record in flight is completed even when the plan is canceled meanwhile, so an endpoint
+		// is not left with some of its targets updated.
+		log.Debug("updating endpoint", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+		err := p.client.UpdateEndpoint(context.WithoutCancel(ctx), old, ep)
+		report.add("update", ep, err)
+		if err != nil {
+			log.Error("failed to update endpoint", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType), zap.Error(err))
+			return nil, err
+		}
+		p.applied.forget(old)
+		p.applied.remember(ep)
+		countChange("update", ep)
 	}
 
+	for _, old := range olds {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		log.Debug("deleting endpoint", zap.String("name", old.DNSName), zap.String("type", old.RecordType))
+		err := p.client.DeleteEndpoint(old)
+		report.add("delete", old, err)
+		if err != nil {
+			log.Error("failed to delete endpoint", zap.String("name", old.DNSName), zap.String("type", old.RecordType), zap.Error(err))
+			return nil, err
+		}
+		p.applied.forget(old)
+		countChange("delete", old)
+	}
+
+	return creates, nil
+}
+
+// countChange counts an applied change. Updates applied in place are counted as such rather
+// than as a delete and a create, so churn can be told apart from growth.
+func countChange(operation string, ep *endpoint.Endpoint) {
+	metrics.ChangesTotal.WithLabelValues(operation).Inc()
+	metrics.ChangesByTypeTotal.WithLabelValues(operation, ep.RecordType).Inc()
+}
+
+// AdjustEndpoints canonicalizes the endpoints so they compare equal to the ones returned by Records.
+func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	for _, ep := range endpoints {
+		normalizeEndpoint(ep)
+		adjustProviderSpecific(ep)
+		ep.RecordTTL = p.client.readTTL(p.config.desiredTTL(ep.RecordType, ep.RecordTTL))
+	}
+	endpoints = filterUnsupported(endpoints)
+	endpoints = p.recordTypes.filterEndpoints(endpoints)
+	endpoints = expandWildcards(p.config.WildcardLabels, endpoints)
+	endpoints = filterIPv6(p.config.IPv6Policy, endpoints)
+	endpoints = filterTargetNets(p.targetFilter, endpoints)
+	endpoints = filterTargetRegex(p.targetRegex, endpoints)
+	return endpoints, nil
+}
+
+// Ready returns an error while the provider cannot reach the UniFi controller and has no
+// snapshot to serve, or once the configured number of consecutive operations failed.
+// The next successful operation recovers it.
+func (p *Provider) Ready() error {
+	if err := p.client.Ready(); err != nil {
+		p.state.RLock()
+		defer p.state.RUnlock()
+		if p.servableFallback() != nil {
+			return nil
+		}
+		return err
+	}
+
+	threshold := p.config.ReadinessErrorThreshold
+	if threshold <= 0 {
+		return nil
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	if p.state.consecutiveErrors >= threshold {
+		return fmt.Errorf("%d consecutive operations failed: %w", p.state.consecutiveErrors, p.state.lastError)
+	}
+	return nil
+}
+
+// Degraded returns why the provider serves requests in a degraded way: from the snapshot,
+// while logins are retried, or after failed operations. It returns nil when fully ready.
+func (p *Provider) Degraded() error {
+	if err := p.client.Ready(); err != nil {
+		return fmt.Errorf("serving stale records: %w", err)
+	}
+
+	if loginFailures := p.client.loginFailures(); loginFailures > 0 {
+		return fmt.Errorf("retrying authentication after %d rejected logins", loginFailures)
+	}
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+	if p.state.stale {
+		return errors.New("serving stale records")
+	}
+	if p.state.consecutiveErrors > 0 {
+		return fmt.Errorf("last %d operations failed: %w", p.state.consecutiveErrors, p.state.lastError)
+	}
 	return nil
 }
 
+// RawRecords returns the records exactly as the UniFi controller sent them.
+func (p *Provider) RawRecords(ctx context.Context) ([]byte, error) {
+	return p.client.RawRecords(ctx)
+}
+
 // GetDomainFilter returns the domain filter for the provider.
 func (p *Provider) GetDomainFilter() endpoint.DomainFilterInterface {
 	return p.domainFilter
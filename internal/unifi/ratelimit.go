@@ -0,0 +1,73 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAfter = 30 * time.Second
+	maxRetryAfter     = 15 * time.Minute
+)
+
+// RateLimitError is returned while the controller is rate limiting the client.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited by the unifi controller, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// HTTPStatusCode reports the rate limit to external-dns as such.
+func (e *RateLimitError) HTTPStatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// RetryDelay returns the time until requests are sent to the controller again.
+func (e *RateLimitError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+// rateLimit holds requests back until the backoff requested by the controller has passed.
+type rateLimit struct {
+	sync.Mutex
+	until time.Time
+}
+
+// check returns a RateLimitError while the client is backing off.
+func (r *rateLimit) check() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if wait := time.Until(r.until); wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// backoff holds requests back for the given duration.
+func (r *rateLimit) backoff(d time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	if until := time.Now().Add(d); until.After(r.until) {
+		r.until = until
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+// Missing or invalid values fall back to a default, and the result is capped so a bogus value
+// cannot stall the webhook indefinitely.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	d := defaultRetryAfter
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = date.Sub(now)
+	}
+	return min(max(d, time.Second), maxRetryAfter)
+}
@@ -0,0 +1,145 @@
+package unifi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// appliedRecords remembers the endpoints created by the webhook so records removed
+// behind its back, for example in the UniFi UI, can be recreated.
+type appliedRecords struct {
+	sync.Mutex
+	endpoints map[endpoint.EndpointKey]*endpoint.Endpoint
+}
+
+// remember records a created endpoint.
+func (a *appliedRecords) remember(ep *endpoint.Endpoint) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.endpoints == nil {
+		a.endpoints = map[endpoint.EndpointKey]*endpoint.Endpoint{}
+	}
+	key := endpoint.EndpointKey{DNSName: normalizeName(ep.DNSName), RecordType: ep.RecordType}
+	if existing, ok := a.endpoints[key]; ok {
+		merged := existing.DeepCopy()
+		merged.Targets = append(merged.Targets, ep.Targets...)
+		normalizeEndpoint(merged)
+		a.endpoints[key] = merged
+		return
+	}
+	a.endpoints[key] = ep.DeepCopy()
+}
+
+// forget drops the targets of a deleted endpoint.
+func (a *appliedRecords) forget(ep *endpoint.Endpoint) {
+	a.Lock()
+	defer a.Unlock()
+
+	key := endpoint.EndpointKey{DNSName: normalizeName(ep.DNSName), RecordType: ep.RecordType}
+	existing, ok := a.endpoints[key]
+	if !ok {
+		return
+	}
+
+	deleted := map[string]bool{}
+	for _, target := range ep.Targets {
+		deleted[normalizeTarget(ep.RecordType, target)] = true
+	}
+
+	remaining := existing.DeepCopy()
+	remaining.Targets = nil
+	for _, target := range existing.Targets {
+		if !deleted[normalizeTarget(ep.RecordType, target)] {
+			remaining.Targets = append(remaining.Targets, target)
+		}
+	}
+
+	if len(remaining.Targets) == 0 {
+		delete(a.endpoints, key)
+		return
+	}
+	a.endpoints[key] = remaining
+}
+
+// snapshot returns copies of the remembered endpoints.
+func (a *appliedRecords) snapshot() []*endpoint.Endpoint {
+	a.Lock()
+	defer a.Unlock()
+
+	endpoints := make([]*endpoint.Endpoint, 0, len(a.endpoints))
+	for _, ep := range a.endpoints {
+		endpoints = append(endpoints, ep.DeepCopy())
+	}
+	return endpoints
+}
+
+// reconcileLoop periodically refreshes the record cache and repairs applied records
+// that no longer exist on the controller, independent of the external-dns interval.
+func (p *Provider) reconcileLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if p.client.Ready() != nil || !IsLeader() {
+			continue
+		}
+		if err := p.reconcile(); err != nil {
+			log.Error("reconcile failed", zap.Error(err))
+		}
+	}
+}
+
+// reconcile recreates the targets of applied endpoints that are missing on the controller.
+func (p *Provider) reconcile() error {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+
+	records, err := p.client.GetEndpoints()
+	if err != nil {
+		p.state.failure(err)
+		return err
+	}
+	p.state.success(records)
+
+	existing := map[string]bool{}
+	for _, r := range records {
+		existing[normalizeName(r.Key)+"/"+r.RecordType+"/"+normalizeTarget(r.RecordType, r.Value)] = true
+	}
+
+	var owned map[string]bool
+	if p.config.Ownership {
+		owned = p.ownedNames(records)
+	}
+
+	for _, ep := range p.applied.snapshot() {
+		missing := ep.DeepCopy()
+		missing.Targets = nil
+		for _, target := range ep.Targets {
+			if !existing[normalizeName(ep.DNSName)+"/"+ep.RecordType+"/"+normalizeTarget(ep.RecordType, target)] {
+				missing.Targets = append(missing.Targets, target)
+			}
+		}
+		if len(missing.Targets) == 0 {
+			continue
+		}
+
+		log.Warn("repairing record missing on the controller", zap.String("name", missing.DNSName), zap.String("type", missing.RecordType), zap.Strings("targets", missing.Targets))
+		if p.config.Ownership {
+			if err := p.claim(missing.DNSName, owned); err != nil {
+				return err
+			}
+		}
+		if _, err := p.client.CreateEndpoint(missing); err != nil {
+			return err
+		}
+		metrics.RecordsRepairedTotal.Add(float64(len(missing.Targets)))
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package unifi
+
+import (
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// createdRecords are the records created by a plan, kept to roll them back when the plan fails.
+type createdRecords struct {
+	endpoint *endpoint.Endpoint
+	records  []*DNSRecord
+}
+
+// rollback deletes the records created by a failed plan, so the retry of the next sync does not
+// conflict with a half-applied plan. Rollback is best effort, failures are only logged.
+func (p *Provider) rollback(created []createdRecords, report *applyReport) {
+	for i := len(created) - 1; i >= 0; i-- {
+		c := created[i]
+		var failed error
+		for _, record := range c.records {
+			if err := p.client.deleteRecord(*record); err != nil {
+				log.Error("failed to roll back created record", zap.String("name", record.Key), zap.String("type", record.RecordType), zap.String("value", record.Value), zap.Error(err))
+				metrics.RollbackRecordsTotal.WithLabelValues("error").Inc()
+				failed = err
+				continue
+			}
+			metrics.RollbackRecordsTotal.WithLabelValues("success").Inc()
+		}
+		if failed == nil {
+			p.applied.forget(c.endpoint)
+		}
+		report.add("rollback", c.endpoint, failed)
+		log.Info("rolled back created endpoint", zap.String("name", c.endpoint.DNSName), zap.String("type", c.endpoint.RecordType), zap.Int("records", len(c.records)))
+	}
+}
@@ -0,0 +1,139 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	loginBackoffMinInterval = 30 * time.Second
+	loginBackoffMaxInterval = 30 * time.Minute
+)
+
+// session holds the state of the cookie based session with the controller.
+type session struct {
+	sync.RWMutex
+	tenant     string
+	csrf       string
+	loggedInAt time.Time
+
+	loginFailures      int
+	loginDisabledUntil time.Time
+}
+
+// CSRF returns the current CSRF token.
+func (s *session) CSRF() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.csrf
+}
+
+// setCSRF stores a CSRF token returned by the controller, ignoring empty tokens.
+func (s *session) setCSRF(csrf string) {
+	if csrf == "" {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.csrf = csrf
+}
+
+// loggedIn records a successful login.
+func (s *session) loggedIn(csrf string) {
+	s.Lock()
+	defer s.Unlock()
+	if csrf != "" {
+		s.csrf = csrf
+	}
+	s.loggedInAt = time.Now()
+	s.loginFailures = 0
+	s.loginDisabledUntil = time.Time{}
+	metrics.LoginDisabledUntil.WithLabelValues(s.tenant).Set(0)
+}
+
+// loginAllowed returns an UnavailableError wrapping an AuthError while logins are backing off
+// after rejected attempts.
+func (s *session) loginAllowed() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	if wait := time.Until(s.loginDisabledUntil); wait > 0 {
+		return &UnavailableError{
+			Err:        &AuthError{Err: fmt.Errorf("login disabled until %s after %d rejected attempts", s.loginDisabledUntil.Format(time.RFC3339), s.loginFailures)},
+			RetryAfter: wait,
+		}
+	}
+	return nil
+}
+
+// loginFailed records a rejected login and returns how long further logins are disabled.
+func (s *session) loginFailed() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+
+	s.loginFailures++
+	backoff := loginBackoffMinInterval
+	for i := 1; i < s.loginFailures && backoff < loginBackoffMaxInterval; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, loginBackoffMaxInterval)
+
+	s.loginDisabledUntil = time.Now().Add(backoff)
+	metrics.LoginFailuresTotal.Inc()
+	metrics.LoginDisabledUntil.WithLabelValues(s.tenant).Set(float64(s.loginDisabledUntil.Unix()))
+	return backoff
+}
+
+// age returns the time since the last successful login.
+func (s *session) age() time.Duration {
+	s.RLock()
+	defer s.RUnlock()
+	return time.Since(s.loggedInAt)
+}
+
+// keepalive periodically touches the session so it does not expire from inactivity,
+// and logs in again once the session is older than the configured maximum age.
+// It returns once the client is closed.
+func (c *httpClient) keepalive() {
+	if c.apiKey != nil || c.Config.SessionKeepalive <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.Config.SessionKeepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if c.Ready() != nil {
+			continue
+		}
+
+		if c.Config.SessionMaxAge > 0 && c.session.age() >= c.Config.SessionMaxAge {
+			log.Debug("session reached its maximum age, logging in again")
+			if err := c.login(); err != nil {
+				log.Error("proactive re-login failed", zap.Error(err))
+			}
+			continue
+		}
+
+		resp, err := c.doRequest(http.MethodGet, c.selfURL(), nil)
+		if err != nil {
+			log.Error("session keepalive failed", zap.Error(err))
+			continue
+		}
+		resp.Body.Close()
+		log.Debug("session keepalive succeeded")
+	}
+}
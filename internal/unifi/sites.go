@@ -0,0 +1,61 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+const unifiSitesPath = "/api/self/sites"
+
+// Site is a site of the UniFi controller.
+type Site struct {
+	Name        string `json:"name"`
+	Description string `json:"desc"`
+}
+
+// listSites returns the sites visible to the authenticated user.
+func (c *httpClient) listSites() ([]Site, error) {
+	resp, err := c.doRequest(http.MethodGet, c.networkURL(unifiSitesPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var sites struct {
+		Data []Site `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sites); err != nil {
+		return nil, &DataError{Err: err}
+	}
+	return sites.Data, nil
+}
+
+// resolveSite returns the internal name of the configured site, accepting either the internal
+// name or the display name shown in the UI. Sites that cannot be listed are used as configured.
+func (c *httpClient) resolveSite() (string, error) {
+	sites, err := c.listSites()
+	if err != nil {
+		log.Warn("failed to list sites, using the configured site as is", zap.String("site", c.Config.Site), zap.Error(err))
+		return c.Config.Site, nil
+	}
+
+	var names []string
+	for _, site := range sites {
+		if site.Name == c.Config.Site {
+			return site.Name, nil
+		}
+		names = append(names, fmt.Sprintf("%s (%s)", site.Name, site.Description))
+	}
+	for _, site := range sites {
+		if strings.EqualFold(site.Description, c.Config.Site) {
+			log.Info("resolved site by display name", zap.String("site", c.Config.Site), zap.String("name", site.Name))
+			return site.Name, nil
+		}
+	}
+	return "", fmt.Errorf("site %q not found, available sites: %s", c.Config.Site, strings.Join(names, ", "))
+}
@@ -0,0 +1,162 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// recordSnapshot is the last known record listing persisted across restarts.
+type recordSnapshot struct {
+	SavedAt time.Time `json:"savedAt"`
+	// Host is the normalized controller URL and Site the internal site name.
+	Host string `json:"host"`
+	Site string `json:"site"`
+	// ConfiguredSite is the site as configured, possibly its display name.
+	ConfiguredSite string      `json:"configuredSite,omitempty"`
+	Records        []DNSRecord `json:"records"`
+}
+
+// loadSnapshot reads the persisted snapshot of the controller and site of the client. The site
+// matches by its internal name once resolved, and by the configured name while the controller
+// has not answered yet. A missing, foreign or expired snapshot is not an error and returns nil.
+func loadSnapshot(config *Config, site string) (*recordSnapshot, error) {
+	if config.SnapshotFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(config.SnapshotFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record snapshot %s: %w", config.SnapshotFile, err)
+	}
+
+	var snapshot recordSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode record snapshot %s: %w", config.SnapshotFile, err)
+	}
+	sameSite := snapshot.Site == site || (snapshot.ConfiguredSite != "" && snapshot.ConfiguredSite == config.Site)
+	if snapshot.Host != config.Host || !sameSite {
+		log.Warn("ignoring record snapshot of another controller", zap.String("file", config.SnapshotFile), zap.String("host", snapshot.Host), zap.String("site", snapshot.Site))
+		return nil, nil
+	}
+	if config.SnapshotMaxAge > 0 && time.Since(snapshot.SavedAt) > config.SnapshotMaxAge {
+		log.Warn("ignoring expired record snapshot", zap.String("file", config.SnapshotFile), zap.Time("saved_at", snapshot.SavedAt))
+		return nil, nil
+	}
+
+	log.Info("loaded record snapshot", zap.String("file", config.SnapshotFile), zap.Time("saved_at", snapshot.SavedAt), zap.Int("count", len(snapshot.Records)))
+	return &snapshot, nil
+}
+
+// saveSnapshot persists the records, replacing the previous snapshot atomically.
+func saveSnapshot(config *Config, site string, records []DNSRecord) error {
+	data, err := json.Marshal(recordSnapshot{
+		SavedAt:        time.Now().UTC(),
+		Host:           config.Host,
+		Site:           site,
+		ConfiguredSite: config.Site,
+		Records:        records,
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(config.SnapshotFile)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create record snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(config.SnapshotFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write record snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write record snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write record snapshot: %w", err)
+	}
+	return os.Rename(tmp.Name(), config.SnapshotFile)
+}
+
+// servableFallback returns the last known listing when it may be served instead of the
+// controller: a snapshot loaded at startup, or a listing younger than the stale records limit.
+// The caller holds the state lock.
+func (p *Provider) servableFallback() *recordSnapshot {
+	fallback := p.state.fallback
+	if fallback == nil {
+		return nil
+	}
+	if p.state.warm {
+		return fallback
+	}
+	maxAge := p.config.StaleRecordsMaxAge
+	if maxAge <= 0 || time.Since(fallback.SavedAt) >= maxAge {
+		return nil
+	}
+	return fallback
+}
+
+// listRecords lists the controller records and persists them as snapshot. A failed listing is
+// answered from the last known listing when it may still be served, which reports stale as true.
+func (p *Provider) listRecords() (records []DNSRecord, stale bool, err error) {
+	records, err = p.client.GetEndpoints()
+	if err != nil {
+		p.state.failure(err)
+
+		p.state.Lock()
+		fallback := p.servableFallback()
+		p.state.stale = fallback != nil
+		p.state.Unlock()
+		if fallback == nil {
+			return nil, false, err
+		}
+
+		age := time.Since(fallback.SavedAt)
+		metrics.RecordsStale.WithLabelValues(p.config.Tenant).Set(1)
+		metrics.RecordsStaleAge.WithLabelValues(p.config.Tenant).Set(age.Seconds())
+		log.Warn("serving stale records while the controller is unavailable", zap.Time("saved_at", fallback.SavedAt), zap.Duration("age", age), zap.Error(err))
+		return fallback.Records, true, nil
+	}
+
+	p.state.Lock()
+	p.state.fallback = &recordSnapshot{SavedAt: time.Now(), Records: records}
+	p.state.warm = false
+	p.state.stale = false
+	saved := p.state.saved
+	p.state.Unlock()
+	metrics.RecordsStale.WithLabelValues(p.config.Tenant).Set(0)
+	metrics.RecordsStaleAge.WithLabelValues(p.config.Tenant).Set(0)
+
+	if p.config.SnapshotFile != "" && !reflect.DeepEqual(saved, records) {
+		if err := saveSnapshot(p.config, p.client.site(), records); err != nil {
+			log.Warn("failed to persist the record snapshot", zap.Error(err))
+		} else {
+			p.state.Lock()
+			p.state.saved = records
+			p.state.Unlock()
+		}
+	}
+	return records, false, nil
+}
+
+// RecordsStale returns whether the last record listing was served from the last known listing.
+func (p *Provider) RecordsStale() bool {
+	p.state.RLock()
+	defer p.state.RUnlock()
+	return p.state.stale
+}
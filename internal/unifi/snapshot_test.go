@@ -0,0 +1,56 @@
+package unifi
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kashalls/external-dns-unifi-webhook/pkg/unifitest"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestSnapshotMatchesNormalizedHostAndResolvedSite(t *testing.T) {
+	tests := []struct {
+		name        string
+		unreachable bool
+	}{
+		{name: "controller reachable"},
+		{name: "controller unreachable", unreachable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, unifitest.Options{})
+			c.SetRecords("default", unifitest.Record{Enabled: true, Key: "web.lan", RecordType: "A", Value: "10.0.0.1"})
+			environment := map[string]string{
+				"UNIFI_SNAPSHOT_FILE": filepath.Join(t.TempDir(), "snapshot.json"),
+				// The site is configured by its display name, and the host without a scheme.
+				"UNIFI_SITE": "DEFAULT",
+			}
+			newProvider := func() *Provider {
+				config := newTestConfig(t, c, false, environment)
+				config.Host = strings.TrimPrefix(c.URL, "https://")
+				p, err := NewUnifiProvider(endpoint.DomainFilter{}, endpoint.TargetNetFilter{}, config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p.(*Provider)
+			}
+
+			if _, err := newProvider().Records(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if tt.unreachable {
+				c.Close()
+			}
+
+			p := newProvider()
+			p.state.RLock()
+			defer p.state.RUnlock()
+			if p.state.fallback == nil || len(p.state.fallback.Records) != 1 {
+				t.Errorf("snapshot not loaded: %+v", p.state.fallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package unifi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/envconfig"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Status is a snapshot of the provider runtime state.
+type Status struct {
+	InstanceID        string           `json:"instanceId"`
+	AuthMode          string           `json:"authMode"`
+	Controller        ControllerStatus `json:"controller"`
+	Session           *SessionStatus   `json:"session,omitempty"`
+	LastSync          *time.Time       `json:"lastSync,omitempty"`
+	LastError         string           `json:"lastError,omitempty"`
+	RecordCounts      map[string]int   `json:"recordCounts"`
+	ConsecutiveErrors int              `json:"consecutiveErrors"`
+	Leader            bool             `json:"leader"`
+	RecordsStale      bool             `json:"recordsStale"`
+}
+
+// ControllerStatus describes the connection to the UniFi controller.
+type ControllerStatus struct {
+	Host      string `json:"host"`
+	Site      string `json:"site"`
+	Connected bool   `json:"connected"`
+	External  bool   `json:"external"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// CircuitOpenUntil is set while requests to the controller are held back after consecutive failures.
+	CircuitOpenUntil *time.Time `json:"circuitOpenUntil,omitempty"`
+}
+
+// SessionStatus describes the cookie session used with username and password authentication.
+type SessionStatus struct {
+	LoggedInAt         *time.Time `json:"loggedInAt,omitempty"`
+	HasCSRF            bool       `json:"hasCsrf"`
+	LoginFailures      int        `json:"loginFailures"`
+	LoginDisabledUntil *time.Time `json:"loginDisabledUntil,omitempty"`
+}
+
+// runtimeState tracks the outcome of the operations served by the provider.
+type runtimeState struct {
+	sync.RWMutex
+	tenant            string
+	lastSync          time.Time
+	lastError         error
+	records           []DNSRecord
+	recordCounts      map[string]int
+	consecutiveErrors int
+
+	// fallback is the last known listing, served while the controller is unavailable.
+	fallback *recordSnapshot
+	// warm reports whether the fallback is the snapshot loaded at startup.
+	warm bool
+	// saved are the records of the last persisted snapshot.
+	saved []DNSRecord
+	stale bool
+}
+
+// success records a successful operation, updating the record counts when records are given.
+func (s *runtimeState) success(records []DNSRecord) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastSync = time.Now()
+	s.consecutiveErrors = 0
+	metrics.ConsecutiveErrors.WithLabelValues(s.tenant).Set(0)
+
+	if records != nil {
+		s.records = records
+		s.recordCounts = map[string]int{}
+		for _, r := range records {
+			s.recordCounts[r.RecordType]++
+		}
+	}
+}
+
+// failure records a failed operation.
+func (s *runtimeState) failure(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastError = err
+	s.consecutiveErrors++
+	metrics.ErrorsTotal.WithLabelValues(errorClass(err)).Inc()
+	metrics.ConsecutiveErrors.WithLabelValues(s.tenant).Set(float64(s.consecutiveErrors))
+}
+
+// Status returns a snapshot of the provider runtime state.
+func (p *Provider) Status() any {
+	status := Status{
+		InstanceID:   p.instanceID,
+		Controller:   p.client.controllerStatus(),
+		RecordCounts: map[string]int{},
+		Leader:       IsLeader(),
+	}
+	status.AuthMode, status.Session = p.client.sessionStatus()
+
+	p.state.RLock()
+	defer p.state.RUnlock()
+
+	if !p.state.lastSync.IsZero() {
+		lastSync := p.state.lastSync
+		status.LastSync = &lastSync
+	}
+	if p.state.lastError != nil {
+		status.LastError = p.state.lastError.Error()
+	}
+	for recordType, count := range p.state.recordCounts {
+		status.RecordCounts[recordType] = count
+	}
+	status.ConsecutiveErrors = p.state.consecutiveErrors
+	status.RecordsStale = p.state.stale
+
+	return status
+}
+
+// controllerStatus describes the connection to the controller.
+func (c *httpClient) controllerStatus() ControllerStatus {
+	status := ControllerStatus{
+		Host: c.Config.Host,
+		Site: c.site(),
+	}
+
+	if err := c.Ready(); err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Connected = true
+		layout := c.layout.Load()
+		status.External = layout.external
+		if layout.version != (controllerVersion{}) {
+			status.Version = layout.version.String()
+		}
+	}
+
+	if until := c.circuit.until(); !until.IsZero() {
+		status.CircuitOpenUntil = &until
+	}
+	return status
+}
+
+// sessionStatus returns the authentication mode, and the session when logging in with a username and password.
+func (c *httpClient) sessionStatus() (string, *SessionStatus) {
+	if c.apiKey != nil {
+		return "api-key", nil
+	}
+
+	c.session.RLock()
+	defer c.session.RUnlock()
+	session := &SessionStatus{
+		HasCSRF:       c.session.csrf != "",
+		LoginFailures: c.session.loginFailures,
+	}
+	if !c.session.loggedInAt.IsZero() {
+		loggedInAt := c.session.loggedInAt
+		session.LoggedInAt = &loggedInAt
+	}
+	if time.Now().Before(c.session.loginDisabledUntil) {
+		disabledUntil := c.session.loginDisabledUntil
+		session.LoginDisabledUntil = &disabledUntil
+	}
+	return "password", session
+}
+
+// loginFailures returns the number of consecutive rejected logins.
+func (c *httpClient) loginFailures() int {
+	c.session.RLock()
+	defer c.session.RUnlock()
+	return c.session.loginFailures
+}
+
+// HealthChecks returns the checks of the UniFi transport and the record cache.
+func (p *Provider) HealthChecks() map[string]func() error {
+	return map[string]func() error{
+		"unifi": p.client.Ready,
+		"cache": func() error {
+			p.state.RLock()
+			defer p.state.RUnlock()
+			if p.state.consecutiveErrors > 0 {
+				return fmt.Errorf("last %d syncs failed: %w", p.state.consecutiveErrors, p.state.lastError)
+			}
+			return nil
+		},
+	}
+}
+
+// DumpState logs a point-in-time snapshot of the cached records, the session and the last error chain.
+func (p *Provider) DumpState() {
+	status := p.Status().(Status)
+
+	p.state.RLock()
+	records := p.state.records
+	var chain []string
+	for err := p.state.lastError; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
+	}
+	p.state.RUnlock()
+
+	log.Info("state dump",
+		zap.Any("status", status),
+		zap.Strings("error_chain", chain),
+		zap.Int("record_count", len(records)),
+		zap.Any("records", records),
+	)
+}
+
+// EffectiveConfig returns the configuration of the provider keyed by environment variable, with secrets masked.
+func (p *Provider) EffectiveConfig() any {
+	return envconfig.Describe(p.config)
+}
@@ -0,0 +1,95 @@
+package unifi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+)
+
+// tlsVersions are the accepted values of UNIFI_TLS_MIN_VERSION.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns the TLS configuration of the connections to the controller, restricted to
+// the configured minimum version and cipher suites. Cipher suites are named as by crypto/tls,
+// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, and only apply up to TLS 1.2.
+func newTLSConfig(config *Config) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[config.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid UNIFI_TLS_MIN_VERSION %q: use 1.0, 1.1, 1.2 or 1.3", config.TLSMinVersion)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.SkipTLSVerify,
+		MinVersion:         minVersion,
+	}
+	if len(config.TLSFingerprints) > 0 {
+		pins, err := parseFingerprints(config.TLSFingerprints)
+		if err != nil {
+			return nil, err
+		}
+		// The pinned certificate replaces the verification against the system roots, so
+		// self-signed controller certificates are accepted without shipping a CA bundle.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = verifyFingerprint(pins)
+	}
+	if len(config.TLSCipherSuites) == 0 {
+		return tlsConfig, nil
+	}
+
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range config.TLSCipherSuites {
+		id, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid UNIFI_TLS_CIPHER_SUITES: unknown or insecure cipher suite %q", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+	if minVersion == tls.VersionTLS13 {
+		log.Warn("UNIFI_TLS_CIPHER_SUITES has no effect with TLS 1.3, whose cipher suites are not configurable")
+	}
+	return tlsConfig, nil
+}
+
+// parseFingerprints decodes SHA-256 fingerprints given in hex, optionally separated by colons
+// as printed by openssl x509 -fingerprint -sha256.
+func parseFingerprints(values []string) ([][]byte, error) {
+	var pins [][]byte
+	for _, value := range values {
+		pin, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(value), ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid UNIFI_TLS_FINGERPRINT %q: expected a hex encoded SHA-256 fingerprint", value)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// verifyFingerprint accepts connections whose leaf certificate matches one of the pinned fingerprints.
+func verifyFingerprint(pins [][]byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("controller presented no certificate")
+		}
+		sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+		for _, pin := range pins {
+			if bytes.Equal(sum[:], pin) {
+				return nil
+			}
+		}
+		return fmt.Errorf("controller certificate fingerprint %s does not match UNIFI_TLS_FINGERPRINT", hex.EncodeToString(sum[:]))
+	}
+}
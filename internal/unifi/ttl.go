@@ -0,0 +1,51 @@
+package unifi
+
+import (
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// The controller stores records created without a TTL with its default TTL. Unless the default is
+// configured, it is learned from the first record created without a TTL.
+
+// desiredTTL returns the TTL a record of the type requested with the given TTL should have: the
+// forced TTL when configured, else the default TTL of its type when the TTL is unset.
+func (c *Config) desiredTTL(recordType string, ttl endpoint.TTL) endpoint.TTL {
+	if c.ForceTTL > 0 {
+		return endpoint.TTL(c.ForceTTL)
+	}
+	if typeTTL := c.TypeTTLs[recordType]; ttl == 0 && typeTTL > 0 {
+		return endpoint.TTL(typeTTL)
+	}
+	return ttl
+}
+
+// writeTTL returns the TTL stored for a record of the type requested with the given TTL.
+// An unset TTL is mapped to the controller default once known.
+func (c *httpClient) writeTTL(recordType string, ttl endpoint.TTL) endpoint.TTL {
+	ttl = c.desiredTTL(recordType, ttl)
+	if ttl == 0 {
+		return endpoint.TTL(c.defaultTTL.Load())
+	}
+	return ttl
+}
+
+// readTTL returns the TTL reported for a record stored with the given TTL, mapping the controller
+// default back to an unset TTL so endpoints without a TTL converge.
+func (c *httpClient) readTTL(ttl endpoint.TTL) endpoint.TTL {
+	if defaultTTL := c.defaultTTL.Load(); defaultTTL != 0 && int64(ttl) == defaultTTL {
+		return 0
+	}
+	return ttl
+}
+
+// learnDefaultTTL remembers the TTL the controller assigned to a record created without one.
+func (c *httpClient) learnDefaultTTL(requested, created DNSRecord) {
+	if requested.TTL != 0 || created.TTL <= 0 {
+		return
+	}
+	if c.defaultTTL.CompareAndSwap(0, int64(created.TTL)) {
+		log.Info("learned the controller default ttl", zap.Int64("ttl", int64(created.TTL)))
+	}
+}
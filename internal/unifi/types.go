@@ -1,17 +1,69 @@
 package unifi
 
 import (
+	"time"
+
 	"sigs.k8s.io/external-dns/endpoint"
 )
 
 // Config represents the configuration for the UniFi API.
 type Config struct {
-	Host               string `env:"UNIFI_HOST,notEmpty"`
-	User               string `env:"UNIFI_USER,notEmpty"`
-	Password           string `env:"UNIFI_PASS,notEmpty"`
-	Site               string `env:"UNIFI_SITE" envDefault:"default"`
-	ExternalController bool   `env:"UNIFI_EXTERNAL_CONTROLLER" envDefault:"false"`
-	SkipTLSVerify      bool   `env:"UNIFI_SKIP_TLS_VERIFY" envDefault:"true"`
+	Host                    string           `env:"UNIFI_HOST"`
+	CloudConsoleID          string           `env:"UNIFI_CLOUD_CONSOLE_ID"`
+	User                    string           `env:"UNIFI_USER"`
+	Password                string           `env:"UNIFI_PASS"`
+	TOTPSecret              string           `env:"UNIFI_TOTP_SECRET"`
+	APIKey                  string           `env:"UNIFI_API_KEY"`
+	APIKeyFile              string           `env:"UNIFI_API_KEY_FILE"`
+	APIKeyReloadInterval    time.Duration    `env:"UNIFI_API_KEY_RELOAD_INTERVAL" envDefault:"30s"`
+	SessionKeepalive        time.Duration    `env:"UNIFI_SESSION_KEEPALIVE" envDefault:"5m"`
+	SessionMaxAge           time.Duration    `env:"UNIFI_SESSION_MAX_AGE" envDefault:"1h"`
+	Site                    string           `env:"UNIFI_SITE" envDefault:"default"`
+	DefaultTTL              int64            `env:"UNIFI_DEFAULT_TTL" envDefault:"0"`
+	ForceTTL                int64            `env:"UNIFI_FORCE_TTL" envDefault:"0"`
+	TypeTTLs                map[string]int64 `env:"UNIFI_TYPE_TTLS"`
+	RecordsBackend          string           `env:"UNIFI_RECORDS_BACKEND" envDefault:"static-dns"`
+	ExternalController      *bool            `env:"UNIFI_EXTERNAL_CONTROLLER"`
+	UserAgent               string           `env:"UNIFI_USER_AGENT"`
+	RequestTimeout          time.Duration    `env:"UNIFI_REQUEST_TIMEOUT" envDefault:"30s"`
+	ConnectTimeout          time.Duration    `env:"UNIFI_CONNECT_TIMEOUT" envDefault:"30s"`
+	CircuitBreakerThreshold int              `env:"UNIFI_CIRCUIT_BREAKER_THRESHOLD" envDefault:"5"`
+	CircuitBreakerCooldown  time.Duration    `env:"UNIFI_CIRCUIT_BREAKER_COOLDOWN" envDefault:"30s"`
+	ClientTimeout           time.Duration    `env:"UNIFI_CLIENT_TIMEOUT" envDefault:"2m"`
+	MaxIdleConns            int              `env:"UNIFI_MAX_IDLE_CONNS" envDefault:"100"`
+	MaxIdleConnsPerHost     int              `env:"UNIFI_MAX_IDLE_CONNS_PER_HOST" envDefault:"10"`
+	IdleConnTimeout         time.Duration    `env:"UNIFI_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	TCPKeepAlive            time.Duration    `env:"UNIFI_TCP_KEEPALIVE" envDefault:"30s"`
+	DisableKeepAlives       bool             `env:"UNIFI_DISABLE_KEEPALIVES" envDefault:"false"`
+	SkipTLSVerify           bool             `env:"UNIFI_SKIP_TLS_VERIFY" envDefault:"true"`
+	TLSMinVersion           string           `env:"UNIFI_TLS_MIN_VERSION" envDefault:"1.2"`
+	TLSCipherSuites         []string         `env:"UNIFI_TLS_CIPHER_SUITES"`
+	TLSFingerprints         []string         `env:"UNIFI_TLS_FINGERPRINT"`
+	RecordTypes             []string         `env:"UNIFI_RECORD_TYPES"`
+	ExcludeTargetRegex      string           `env:"EXCLUDE_TARGET_REGEX"`
+	WildcardLabels          []string         `env:"UNIFI_WILDCARD_LABELS"`
+	IPv6Policy              string           `env:"UNIFI_IPV6_POLICY" envDefault:"both"`
+	MaxChanges              int              `env:"UNIFI_MAX_CHANGES" envDefault:"0"`
+	MaxDeletes              int              `env:"UNIFI_MAX_DELETES" envDefault:"0"`
+	DisableDeletes          bool             `env:"UNIFI_DISABLE_DELETES" envDefault:"false"`
+	RollbackOnFailure       bool             `env:"UNIFI_ROLLBACK_ON_FAILURE" envDefault:"false"`
+	PruneDuplicates         bool             `env:"UNIFI_PRUNE_DUPLICATES" envDefault:"false"`
+	ProtectedRecords        []string         `env:"UNIFI_PROTECTED_RECORDS"`
+	Ownership               bool             `env:"UNIFI_OWNERSHIP" envDefault:"false"`
+	OwnershipPrefix         string           `env:"UNIFI_OWNERSHIP_PREFIX" envDefault:"_unifi-webhook."`
+	AuditLog                string           `env:"UNIFI_AUDIT_LOG"`
+	InstanceID              string           `env:"UNIFI_INSTANCE_ID"`
+	InstanceIDFile          string           `env:"UNIFI_INSTANCE_ID_FILE"`
+	SnapshotFile            string           `env:"UNIFI_SNAPSHOT_FILE"`
+	StaleRecordsMaxAge      time.Duration    `env:"UNIFI_STALE_RECORDS_MAX_AGE" envDefault:"15m"`
+	SnapshotMaxAge          time.Duration    `env:"UNIFI_SNAPSHOT_MAX_AGE" envDefault:"24h"`
+	ReconcileInterval       time.Duration    `env:"UNIFI_RECONCILE_INTERVAL" envDefault:"0s"`
+	ReadinessErrorThreshold int              `env:"UNIFI_READINESS_ERROR_THRESHOLD" envDefault:"0"`
+	CNAMEConflictPolicy     string           `env:"UNIFI_CNAME_CONFLICT_POLICY" envDefault:"reject"`
+
+	// Tenant is the name of the tenant served by the provider, empty without tenants.
+	// It labels the metrics of the provider and is not read from the environment.
+	Tenant string
 }
 
 // Login represents a login request to the UniFi API.
@@ -19,12 +71,13 @@ type Login struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Remember bool   `json:"remember"`
+	Token    string `json:"token,omitempty"`
 }
 
 // DNSRecord represents a DNS record in the UniFi API.
 type DNSRecord struct {
 	ID         string       `json:"_id,omitempty"`
-	Enabled    bool         `json:"enabled,omitempty"`
+	Enabled    bool         `json:"enabled"`
 	Key        string       `json:"key"`
 	Port       *int         `json:"port,omitempty"`
 	Priority   *int         `json:"priority,omitempty"`
@@ -1,14 +1,124 @@
 package unifi
 
-import "strings"
-
-// FormatUrl formats a URL with the given parameters.
-func FormatUrl(path string, params ...string) string {
-	segments := strings.Split(path, "%s")
-	for i, param := range params {
-		if param != "" {
-			segments[i] += param
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// joinURL joins the fixed path and the escaped path parameters onto the base URL.
+// The base is a host normalized by normalizeHost, an unparsable base yields an empty URL.
+func joinURL(base, path string, params ...string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+
+	u = u.JoinPath(path)
+	for _, param := range params {
+		u.RawPath = u.EscapedPath() + "/" + url.PathEscape(param)
+		u.Path += "/" + param
+	}
+	return u.String()
+}
+
+// loginURL returns the URL of the login endpoint.
+func (c *httpClient) loginURL() string {
+	return joinURL(c.Config.Host, c.layout.Load().urls.Login)
+}
+
+// selfURL returns the URL of the current user endpoint.
+func (c *httpClient) selfURL() string {
+	return joinURL(c.Config.Host, c.layout.Load().urls.Self)
+}
+
+// networkURL returns the URL of a Network application path.
+func (c *httpClient) networkURL(path string) string {
+	return joinURL(c.Config.Host, c.layout.Load().urls.Network+path)
+}
+
+// recordsURL returns the URL of the records collection of the site, or of a single record.
+// The collection URL keeps its trailing slash as the controller UI sends it.
+func (c *httpClient) recordsURL(id string) string {
+	return c.layout.Load().recordsURL(c.Config.Host, id)
+}
+
+// recordsURL returns the URL of the records collection of the site on host, or of a single record.
+func (l *controllerLayout) recordsURL(host, id string) string {
+	return joinURL(host, l.urls.Network+unifiSitePath, l.site, l.urls.Records, id)
+}
+
+// site returns the internal name of the site, the configured one until it has been resolved.
+func (c *httpClient) site() string {
+	return c.layout.Load().site
+}
+
+// normalizeHost turns the configured controller host into a base URL without a trailing slash.
+// Hosts without a scheme default to https, and bare IPv6 literals are bracketed.
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return "", fmt.Errorf("host is empty")
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q, expected http or https", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("missing hostname")
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("credentials, query and fragment are not allowed")
+	}
+	if port := u.Port(); port != "" {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// ParseSRVTarget parses an SRV target of the form "priority weight port target" into the record.
+// Priority, weight and port must be within 0-65535, and a trailing dot on the target is removed.
+func ParseSRVTarget(target string, record *DNSRecord) error {
+	fields := strings.Fields(target)
+	if len(fields) != 4 {
+		return &DataError{Err: fmt.Errorf("invalid SRV target %q: expected \"priority weight port target\", got %d fields", target, len(fields))}
+	}
+
+	var values [3]int
+	for i, name := range []string{"priority", "weight", "port"} {
+		v, err := strconv.ParseUint(fields[i], 10, 16)
+		if err != nil {
+			return &DataError{Err: fmt.Errorf("invalid SRV target %q: %s %q must be a number between 0 and 65535", target, name, fields[i])}
 		}
+		values[i] = int(v)
+	}
+
+	host := strings.TrimSuffix(fields[3], ".")
+	if host == "" {
+		return &DataError{Err: fmt.Errorf("invalid SRV target %q: empty target host", target)}
 	}
-	return strings.Join(segments, "")
+
+	record.Priority = &values[0]
+	record.Weight = &values[1]
+	record.Port = &values[2]
+	record.Value = host
+	return nil
 }
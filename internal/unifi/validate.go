@@ -0,0 +1,98 @@
+package unifi
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// validateChanges checks every created record before anything is sent to the controller,
+// rejecting the plan with one error per invalid record instead of relaying an opaque controller 400.
+func (p *Provider) validateChanges(changes *plan.Changes) error {
+	var invalid []string
+	for _, ep := range append(changes.Create, changes.UpdateNew...) {
+		if err := validateEndpoint(ep); err != nil {
+			log.Error("invalid record", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType), zap.Error(err))
+			invalid = append(invalid, fmt.Sprintf("%s %s: %s", ep.RecordType, ep.DNSName, err))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return rejectPlan("invalid_record", "%s", strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
+// validateEndpoint checks that the endpoint name is a legal hostname and its targets match the record type.
+func validateEndpoint(ep *endpoint.Endpoint) error {
+	if err := validateHostname(ep.DNSName, true); err != nil {
+		return fmt.Errorf("invalid name: %w", err)
+	}
+
+	for _, target := range ep.Targets {
+		if err := validateTarget(ep.RecordType, target); err != nil {
+			return fmt.Errorf("invalid target %q: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// validateTarget checks a single target against its record type.
+func validateTarget(recordType, target string) error {
+	switch recordType {
+	case "A":
+		addr, err := netip.ParseAddr(target)
+		if err != nil || !addr.Is4() {
+			return fmt.Errorf("not an IPv4 address")
+		}
+	case "AAAA":
+		addr, err := netip.ParseAddr(target)
+		if err != nil || !addr.Is6() || addr.Is4In6() {
+			return fmt.Errorf("not an IPv6 address")
+		}
+	case "CNAME", "NS":
+		return validateHostname(target, false)
+	case "SRV":
+		var record DNSRecord
+		if err := ParseSRVTarget(target, &record); err != nil {
+			return err
+		}
+		return validateHostname(record.Value, false)
+	}
+	return nil
+}
+
+// validateHostname checks the length and characters of a DNS name, optionally allowing a leading wildcard label.
+// Underscores are accepted as they are used by service and ownership marker names.
+func validateHostname(name string, wildcard bool) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("name longer than 253 characters")
+	}
+
+	for i, label := range strings.Split(name, ".") {
+		if wildcard && i == 0 && label == "*" {
+			continue
+		}
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("label %q must be 1 to 63 characters", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label %q must not start or end with a hyphen", label)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return fmt.Errorf("label %q contains invalid character %q", label, r)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"go.uber.org/zap"
+)
+
+const unifiStatusPath = "/status"
+
+var (
+	// minimumVersion is the first Network application version exposing the static-dns API.
+	minimumVersion = controllerVersion{8, 2, 93}
+	// dnsRecordsVersion is the first Network application version that may expose the DNS records API.
+	dnsRecordsVersion = controllerVersion{9, 0, 0}
+	// maximumTestedMajor is the newest Network application major version the webhook was tested against.
+	maximumTestedMajor = 9
+)
+
+// controllerVersion is a parsed Network application version.
+type controllerVersion [3]int
+
+// parseControllerVersion parses versions such as "8.2.93" or "9.0.108-beta".
+func parseControllerVersion(v string) (controllerVersion, error) {
+	var version controllerVersion
+
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 {
+		return version, fmt.Errorf("invalid version: %q", v)
+	}
+
+	for i := 0; i < len(parts) && i < len(version); i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return version, fmt.Errorf("invalid version: %q", v)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+// Less reports whether v is older than other.
+func (v controllerVersion) Less(other controllerVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+func (v controllerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// statusResponse is the unauthenticated status payload of the Network application.
+type statusResponse struct {
+	Meta struct {
+		ServerVersion string `json:"server_version"`
+	} `json:"meta"`
+}
+
+// detectVersion fetches the Network application version and warns about untested versions.
+func (c *httpClient) detectVersion() (controllerVersion, error) {
+	req, err := http.NewRequest(http.MethodGet, c.networkURL(unifiStatusPath), nil)
+	if err != nil {
+		return controllerVersion{}, err
+	}
+	c.setHeaders(req)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return controllerVersion{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return controllerVersion{}, fmt.Errorf("status request returned %s", resp.Status)
+	}
+
+	var status statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return controllerVersion{}, fmt.Errorf("failed to decode status: %w", err)
+	}
+
+	version, err := parseControllerVersion(status.Meta.ServerVersion)
+	if err != nil {
+		return controllerVersion{}, err
+	}
+
+	switch {
+	case version.Less(minimumVersion):
+		log.Warn("unsupported network application version, static dns requires a newer version",
+			zap.Stringer("version", version), zap.Stringer("minimum", minimumVersion))
+	case version[0] > maximumTestedMajor:
+		log.Warn("running against an untested network application version", zap.Stringer("version", version))
+	default:
+		log.Info("detected network application version", zap.Stringer("version", version))
+	}
+
+	return version, nil
+}
@@ -0,0 +1,51 @@
+package unifi
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/metrics"
+	"go.uber.org/zap"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// warnedWildcards remembers the wildcard names already reported, so each is only logged once.
+var warnedWildcards sync.Map
+
+// isWildcard reports whether the name is a wildcard name, which UniFi rejects.
+func isWildcard(name string) bool {
+	return strings.HasPrefix(name, "*.")
+}
+
+// skipWildcard records a skipped wildcard endpoint.
+func skipWildcard(ep *endpoint.Endpoint) {
+	metrics.WildcardEndpointsSkippedTotal.WithLabelValues(ep.RecordType).Inc()
+	if _, warned := warnedWildcards.LoadOrStore(ep.DNSName+"/"+ep.RecordType, true); !warned {
+		log.Warn("skipping wildcard endpoint, wildcard names are not supported by unifi", zap.String("name", ep.DNSName), zap.String("type", ep.RecordType))
+	}
+}
+
+// expandWildcards replaces wildcard endpoints by one endpoint per configured label,
+// or drops them when no labels are configured.
+func expandWildcards(labels []string, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	var expanded []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if !isWildcard(ep.DNSName) {
+			expanded = append(expanded, ep)
+			continue
+		}
+
+		if len(labels) == 0 {
+			skipWildcard(ep)
+			continue
+		}
+
+		for _, label := range labels {
+			concrete := ep.DeepCopy()
+			concrete.DNSName = strings.ToLower(label) + strings.TrimPrefix(ep.DNSName, "*")
+			expanded = append(expanded, concrete)
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,136 @@
+// Package unificlient manages the static DNS records of a UniFi Network controller.
+//
+// It exposes the client used by the webhook, including its transport, session handling
+// and typed errors, so other tools can reuse it:
+//
+//	client, err := unificlient.New("https://192.168.1.1", unificlient.WithAPIKey(key))
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//	records, err := client.GetEndpoints()
+//
+// The client registers its metrics with the default Prometheus registry.
+package unificlient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/unifi"
+	"go.uber.org/zap"
+)
+
+// Record is a DNS record as stored by the controller.
+type Record = unifi.DNSRecord
+
+// API is the set of record operations of the client.
+type API = unifi.UnifiAPI
+
+// Typed errors returned by the client.
+type (
+	AuthError      = unifi.AuthError
+	NetworkError   = unifi.NetworkError
+	APIError       = unifi.APIError
+	DataError      = unifi.DataError
+	RateLimitError = unifi.RateLimitError
+	ConflictError  = unifi.ConflictError
+)
+
+var (
+	// IsAuthError reports whether err is caused by rejected credentials.
+	IsAuthError = unifi.IsAuthError
+	// IsNetworkError reports whether err is caused by an unreachable controller.
+	IsNetworkError = unifi.IsNetworkError
+	// IsAPIError reports whether err is caused by an unexpected controller response status.
+	IsAPIError = unifi.IsAPIError
+	// IsDataError reports whether err is caused by an undecodable controller response.
+	IsDataError = unifi.IsDataError
+	// IsConflictError reports whether err is caused by a record changed on the controller.
+	IsConflictError = unifi.IsConflictError
+)
+
+// Option configures the client.
+type Option func(*unifi.Config)
+
+// WithAPIKey authenticates with an API key.
+func WithAPIKey(key string) Option {
+	return func(c *unifi.Config) { c.APIKey = key }
+}
+
+// WithAPIKeyFile authenticates with the API key read from a file, re-read when it changes.
+func WithAPIKeyFile(path string) Option {
+	return func(c *unifi.Config) { c.APIKeyFile = path }
+}
+
+// WithCredentials authenticates with a username and password.
+func WithCredentials(username, password string) Option {
+	return func(c *unifi.Config) { c.User, c.Password = username, password }
+}
+
+// WithTOTPSecret generates the 2FA code of logins from the base32 TOTP secret.
+func WithTOTPSecret(secret string) Option {
+	return func(c *unifi.Config) { c.TOTPSecret = secret }
+}
+
+// WithSite selects the site by its internal or display name, defaults to "default".
+func WithSite(site string) Option {
+	return func(c *unifi.Config) { c.Site = site }
+}
+
+// WithCloudConsole reaches the console with the given ID through the UniFi cloud.
+func WithCloudConsole(id string) Option {
+	return func(c *unifi.Config) { c.CloudConsoleID = id }
+}
+
+// WithExternalController skips detecting whether the controller is self-hosted.
+func WithExternalController(external bool) Option {
+	return func(c *unifi.Config) { c.ExternalController = &external }
+}
+
+// WithSkipTLSVerify controls the verification of the controller certificate, skipped by default.
+func WithSkipTLSVerify(skip bool) Option {
+	return func(c *unifi.Config) { c.SkipTLSVerify = skip }
+}
+
+// WithRecordsBackend selects the records API: "static-dns", "dns-records" or "auto".
+func WithRecordsBackend(backend string) Option {
+	return func(c *unifi.Config) { c.RecordsBackend = backend }
+}
+
+// WithRequestTimeout limits a single API call including re-login retries.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *unifi.Config) { c.RequestTimeout = timeout }
+}
+
+// WithUserAgent sets the User-Agent sent to the controller.
+func WithUserAgent(userAgent string) Option {
+	return func(c *unifi.Config) { c.UserAgent = userAgent }
+}
+
+// WithAuditLog appends a JSON line per mutation to the file, or to "stdout" or "stderr".
+func WithAuditLog(path string) Option {
+	return func(c *unifi.Config) { c.AuditLog = path }
+}
+
+// SetLogger sets the logger of the client, which discards its logs by default.
+func SetLogger(logger *zap.Logger) {
+	log.SetLogger(logger)
+}
+
+// New returns a client of the controller at host. Options left unset use the defaults of the
+// webhook. The connection is established in the background when the controller is unreachable,
+// Ready reports whether it is established. Close stops the background work of the client.
+func New(host string, opts ...Option) (API, error) {
+	config := unifi.Config{}
+	if err := env.ParseWithOptions(&config, env.Options{Environment: map[string]string{}}); err != nil {
+		return nil, fmt.Errorf("failed to apply the default configuration: %w", err)
+	}
+	config.Host = host
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return unifi.NewClient(&config)
+}
@@ -0,0 +1,326 @@
+// Package unifitest provides a fake UniFi controller for integration tests.
+package unifitest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Record is a static DNS record as stored by the controller.
+type Record struct {
+	ID         string `json:"_id,omitempty"`
+	Enabled    bool   `json:"enabled"`
+	Key        string `json:"key"`
+	Port       *int   `json:"port,omitempty"`
+	Priority   *int   `json:"priority,omitempty"`
+	RecordType string `json:"record_type"`
+	TTL        int64  `json:"ttl,omitempty"`
+	Value      string `json:"value"`
+	Weight     *int   `json:"weight,omitempty"`
+}
+
+// Options configures a fake controller.
+type Options struct {
+	// Username and Password are the accepted login credentials.
+	Username string
+	Password string
+	// APIKey is the accepted X-API-KEY header, empty disables API key authentication.
+	APIKey string
+	// Sites are the site names served, defaults to "default".
+	Sites []string
+	// Version is the reported network application version, defaults to 9.0.114.
+	Version string
+	// External serves the layout of a self-hosted controller instead of a UniFi OS console.
+	External bool
+}
+
+// Fault makes the controller answer matching requests with an error.
+type Fault struct {
+	// Method and Path select the requests, empty values match any. Path matches as a suffix.
+	Method string
+	Path   string
+	// Status is the status code returned.
+	Status int
+	// Header is added to the response, for example a Retry-After header.
+	Header http.Header
+	// Body is the response body, defaults to a UniFi error response.
+	Body string
+	// Times is the number of requests failed, 0 fails every matching request.
+	Times int
+}
+
+// Controller is an httptest based fake UniFi controller with a record store,
+// cookie and CSRF session handling and error injection.
+type Controller struct {
+	*httptest.Server
+
+	opts Options
+
+	mu       sync.Mutex
+	records  map[string][]Record
+	sessions map[string]string
+	faults   []*Fault
+	nextID   int
+	requests []string
+}
+
+// New starts a fake controller serving TLS with a self-signed certificate.
+func New(opts Options) *Controller {
+	if len(opts.Sites) == 0 {
+		opts.Sites = []string{"default"}
+	}
+	if opts.Version == "" {
+		opts.Version = "9.0.114"
+	}
+
+	c := &Controller{
+		opts:     opts,
+		records:  map[string][]Record{},
+		sessions: map[string]string{},
+	}
+	c.Server = httptest.NewTLSServer(http.HandlerFunc(c.serveHTTP))
+	return c
+}
+
+// Records returns a copy of the records of a site.
+func (c *Controller) Records(site string) []Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Record(nil), c.records[site]...)
+}
+
+// SetRecords replaces the records of a site, assigning IDs to records without one.
+func (c *Controller) SetRecords(site string, records ...Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored := make([]Record, 0, len(records))
+	for _, r := range records {
+		if r.ID == "" {
+			r.ID = c.newID()
+		}
+		stored = append(stored, r)
+	}
+	c.records[site] = stored
+}
+
+// Inject registers a fault. Faults are matched in registration order.
+func (c *Controller) Inject(f Fault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults = append(c.faults, &f)
+}
+
+// Requests returns the "METHOD path" of every request served so far.
+func (c *Controller) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.requests...)
+}
+
+func (c *Controller) newID() string {
+	c.nextID++
+	return strconv.Itoa(c.nextID)
+}
+
+func (c *Controller) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+	if c.fault(w, r) {
+		return
+	}
+
+	// UniFi OS consoles serve their own API at the root and the network application under
+	// /proxy/network, self-hosted controllers serve the network application at the root.
+	path, network := r.URL.Path, true
+	if !c.opts.External {
+		path, network = strings.CutPrefix(path, "/proxy/network")
+	}
+
+	switch {
+	case !network && r.Method == http.MethodPost && path == "/api/auth/login",
+		c.opts.External && r.Method == http.MethodPost && path == "/api/login":
+		c.login(w, r)
+	case !network && path == "/api/users/self":
+		if c.authorized(w, r) {
+			writeJSON(w, http.StatusOK, map[string]any{"data": []map[string]string{{"name": c.opts.Username}}})
+		}
+	case !network, path != "/status" && path != "/api/self" && path != "/api/self/sites" && !strings.HasPrefix(path, "/v2/api/site/"):
+		writeError(w, http.StatusNotFound, "api.err.NotFound")
+	case path == "/status":
+		writeJSON(w, http.StatusOK, map[string]any{"meta": map[string]string{"server_version": c.opts.Version}})
+	case !c.authorized(w, r):
+	case path == "/api/self":
+		writeJSON(w, http.StatusOK, map[string]any{"data": []map[string]string{{"name": c.opts.Username}}})
+	case path == "/api/self/sites":
+		var sites []map[string]string
+		for _, site := range c.opts.Sites {
+			sites = append(sites, map[string]string{"name": site, "desc": site})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": sites})
+	default:
+		c.staticDNS(w, r, strings.TrimPrefix(path, "/v2/api/site/"))
+	}
+}
+
+// fault answers the request with the first matching fault.
+func (c *Controller) fault(w http.ResponseWriter, r *http.Request) bool {
+	for i, f := range c.faults {
+		if (f.Method != "" && f.Method != r.Method) || !strings.HasSuffix(r.URL.Path, f.Path) {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				c.faults = append(c.faults[:i], c.faults[i+1:]...)
+			}
+		}
+		for key, values := range f.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		if f.Body != "" {
+			w.WriteHeader(f.Status)
+			w.Write([]byte(f.Body))
+			return true
+		}
+		writeError(w, f.Status, "api.err.Injected")
+		return true
+	}
+	return false
+}
+
+func (c *Controller) login(w http.ResponseWriter, r *http.Request) {
+	var login struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		writeError(w, http.StatusBadRequest, "api.err.Invalid")
+		return
+	}
+	if login.Username != c.opts.Username || login.Password != c.opts.Password || c.opts.Username == "" {
+		writeError(w, http.StatusUnauthorized, "api.err.Invalid")
+		return
+	}
+
+	token, csrf := randomToken(), randomToken()
+	c.sessions[token] = csrf
+	http.SetCookie(w, &http.Cookie{Name: "TOKEN", Value: token, Path: "/", HttpOnly: true})
+	w.Header().Set("X-CSRF-Token", csrf)
+	writeJSON(w, http.StatusOK, map[string]string{"username": login.Username})
+}
+
+// authorized checks the API key or the session cookie, and the CSRF token of mutating requests.
+func (c *Controller) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if c.opts.APIKey != "" && r.Header.Get("X-API-KEY") == c.opts.APIKey {
+		return true
+	}
+
+	cookie, err := r.Cookie("TOKEN")
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "api.err.LoginRequired")
+		return false
+	}
+	csrf, ok := c.sessions[cookie.Value]
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "api.err.LoginRequired")
+		return false
+	}
+	if r.Method != http.MethodGet && r.Header.Get("X-CSRF-Token") != csrf {
+		writeError(w, http.StatusForbidden, "api.err.InvalidCSRF")
+		return false
+	}
+	return true
+}
+
+// staticDNS serves the static-dns API of a site, path is "<site>/static-dns/<id>".
+func (c *Controller) staticDNS(w http.ResponseWriter, r *http.Request, path string) {
+	site, rest, _ := strings.Cut(path, "/")
+	id, ok := strings.CutPrefix(rest, "static-dns")
+	if !ok || !c.siteExists(site) {
+		writeError(w, http.StatusNotFound, "api.err.NotFound")
+		return
+	}
+	id = strings.Trim(id, "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		writeJSON(w, http.StatusOK, append([]Record{}, c.records[site]...))
+	case r.Method == http.MethodPost && id == "":
+		var record Record
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			writeError(w, http.StatusBadRequest, "api.err.Invalid")
+			return
+		}
+		record.ID = c.newID()
+		c.records[site] = append(c.records[site], record)
+		writeJSON(w, http.StatusOK, record)
+	case r.Method == http.MethodPut && id != "":
+		var record Record
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			writeError(w, http.StatusBadRequest, "api.err.Invalid")
+			return
+		}
+		for i := range c.records[site] {
+			if c.records[site][i].ID == id {
+				record.ID = id
+				c.records[site][i] = record
+				writeJSON(w, http.StatusOK, record)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "api.err.NotFound")
+	case r.Method == http.MethodDelete && id != "":
+		for i := range c.records[site] {
+			if c.records[site][i].ID == id {
+				c.records[site] = append(c.records[site][:i], c.records[site][i+1:]...)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "api.err.NotFound")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "api.err.MethodNotAllowed")
+	}
+}
+
+func (c *Controller) siteExists(site string) bool {
+	for _, s := range c.opts.Sites {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of the UniFi API.
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]any{
+		"code":      code,
+		"errorCode": status,
+		"message":   http.StatusText(status),
+	})
+}
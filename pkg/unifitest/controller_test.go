@@ -0,0 +1,194 @@
+package unifitest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const recordsPath = "/proxy/network/v2/api/site/default/static-dns/"
+
+// newClient returns a client trusting the controller certificate and keeping its cookies.
+func newClient(t *testing.T, c *Controller) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := c.Client()
+	client.Jar = jar
+	return client
+}
+
+func do(t *testing.T, client *http.Client, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func newRequest(t *testing.T, method, url, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestLoginAndCSRF(t *testing.T) {
+	c := New(Options{Username: "admin", Password: "secret"})
+	defer c.Close()
+	client := newClient(t, c)
+
+	resp, _ := do(t, client, newRequest(t, http.MethodGet, c.URL+recordsPath, ""))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("listing without a session: got %d, want 401", resp.StatusCode)
+	}
+
+	resp, _ = do(t, client, newRequest(t, http.MethodPost, c.URL+"/api/auth/login", `{"username":"admin","password":"wrong"}`))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password: got %d, want 401", resp.StatusCode)
+	}
+
+	resp, _ = do(t, client, newRequest(t, http.MethodPost, c.URL+"/api/auth/login", `{"username":"admin","password":"secret"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: got %d, want 200", resp.StatusCode)
+	}
+	csrf := resp.Header.Get("X-CSRF-Token")
+	if csrf == "" {
+		t.Fatal("login returned no CSRF token")
+	}
+
+	resp, _ = do(t, client, newRequest(t, http.MethodGet, c.URL+recordsPath, ""))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("listing with a session: got %d, want 200", resp.StatusCode)
+	}
+
+	record := `{"key":"app.example.com","record_type":"A","value":"10.0.0.1","enabled":true}`
+	resp, _ = do(t, client, newRequest(t, http.MethodPost, c.URL+recordsPath, record))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("create without the CSRF token: got %d, want 403", resp.StatusCode)
+	}
+
+	req := newRequest(t, http.MethodPost, c.URL+recordsPath, record)
+	req.Header.Set("X-CSRF-Token", csrf)
+	resp, _ = do(t, client, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create with the CSRF token: got %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestRecordStore(t *testing.T) {
+	c := New(Options{APIKey: "key"})
+	defer c.Close()
+	client := newClient(t, c)
+	c.SetRecords("default", Record{Key: "old.example.com", RecordType: "A", Value: "10.0.0.1"})
+
+	send := func(method, path, body string) (*http.Response, []byte) {
+		req := newRequest(t, method, c.URL+recordsPath+path, body)
+		req.Header.Set("X-API-KEY", "key")
+		return do(t, client, req)
+	}
+
+	resp, body := send(http.MethodPost, "", `{"key":"new.example.com","record_type":"CNAME","value":"old.example.com"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create: got %d, want 200", resp.StatusCode)
+	}
+	var created Record
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" {
+		t.Fatal("created record has no ID")
+	}
+
+	resp, _ = send(http.MethodPut, created.ID, `{"key":"new.example.com","record_type":"CNAME","value":"other.example.com"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update: got %d, want 200", resp.StatusCode)
+	}
+
+	old := c.Records("default")[0]
+	resp, _ = send(http.MethodDelete, old.ID, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: got %d, want 200", resp.StatusCode)
+	}
+	resp, _ = send(http.MethodDelete, old.ID, "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("delete of a missing record: got %d, want 404", resp.StatusCode)
+	}
+
+	resp, body = send(http.MethodGet, "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: got %d, want 200", resp.StatusCode)
+	}
+	var listed []Record
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Value != "other.example.com" {
+		t.Errorf("listed %+v, want only the updated record", listed)
+	}
+}
+
+func TestInjectedFaults(t *testing.T) {
+	c := New(Options{APIKey: "key"})
+	defer c.Close()
+	client := newClient(t, c)
+	c.Inject(Fault{
+		Method: http.MethodGet,
+		Path:   "/static-dns/",
+		Status: http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": {"5"}},
+		Times:  1,
+	})
+
+	list := func() *http.Response {
+		req := newRequest(t, http.MethodGet, c.URL+recordsPath, "")
+		req.Header.Set("X-API-KEY", "key")
+		resp, _ := do(t, client, req)
+		return resp
+	}
+
+	resp := list()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "5" {
+		t.Fatalf("faulted listing: got %d with Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if resp := list(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("listing after the fault expired: got %d, want 200", resp.StatusCode)
+	}
+
+	want := []string{http.MethodGet + " " + recordsPath, http.MethodGet + " " + recordsPath}
+	if got := c.Requests(); !slices.Equal(got, want) {
+		t.Errorf("requests %v, want %v", got, want)
+	}
+}
+
+func TestExternalLayout(t *testing.T) {
+	c := New(Options{APIKey: "key", External: true})
+	defer c.Close()
+	client := newClient(t, c)
+
+	for path, want := range map[string]int{
+		"/v2/api/site/default/static-dns/":               http.StatusOK,
+		"/proxy/network/v2/api/site/default/static-dns/": http.StatusNotFound,
+		"/v2/api/site/other/static-dns/":                 http.StatusNotFound,
+	} {
+		req := newRequest(t, http.MethodGet, c.URL+path, "")
+		req.Header.Set("X-API-KEY", "key")
+		if resp, _ := do(t, client, req); resp.StatusCode != want {
+			t.Errorf("GET %s: got %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/kashalls/external-dns-unifi-webhook/internal/jsonstream"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// decodeChanges decodes the changes endpoint by endpoint, so large plans are not buffered whole.
+// Keys match the fields of plan.Changes case-insensitively, like encoding/json does.
+func decodeChanges(r io.Reader) (*plan.Changes, error) {
+	changes := &plan.Changes{}
+	dec := json.NewDecoder(r)
+	err := jsonstream.DecodeObject(dec, func(key string) error {
+		var list *[]*endpoint.Endpoint
+		switch strings.ToLower(key) {
+		case "create":
+			list = &changes.Create
+		case "updateold":
+			list = &changes.UpdateOld
+		case "updatenew":
+			list = &changes.UpdateNew
+		case "delete":
+			list = &changes.Delete
+		default:
+			return jsonstream.Skip(dec)
+		}
+		return jsonstream.DecodeArray(dec, func(ep *endpoint.Endpoint) { *list = append(*list, ep) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+const (
+	contentTypeJSON  = "application/json"
+	requestIDHeader  = "X-Request-Id"
+	retryAfterHeader = "Retry-After"
+)
+
+// ErrorResponse is the body of a failed request.
+type ErrorResponse struct {
+	// Code is a machine readable error code, e.g. "bad_request" or the reason a plan was rejected.
+	Code string `json:"code"`
+	// Message describes the error.
+	Message string `json:"message"`
+	// Details lists the items the error applies to, if any.
+	Details []string `json:"details,omitempty"`
+	// RequestID identifies the request in the webhook logs.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// errorCoder is implemented by errors carrying a more specific code than their status.
+type errorCoder interface {
+	ErrorCode() string
+}
+
+// retryDelayer is implemented by errors of operations that can be retried after a delay.
+type retryDelayer interface {
+	RetryDelay() time.Duration
+}
+
+// errorDetailer is implemented by errors listing the items they apply to.
+type errorDetailer interface {
+	ErrorDetails() []string
+}
+
+// WriteError writes a JSON error response with the code derived from the status.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, message string, details ...string) {
+	writeErrorResponse(w, r, status, ErrorResponse{Code: statusCode(status), Message: message, Details: details})
+}
+
+// writeProviderError writes the error returned by the provider, answering with the status of typed
+// errors, 504 when the request ran out of time and the fallback status otherwise.
+func writeProviderError(w http.ResponseWriter, r *http.Request, err error, fallback int) {
+	status := fallback
+	var coder statusCoder
+	if errors.As(err, &coder) {
+		status = coder.HTTPStatusCode()
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+
+	resp := ErrorResponse{Code: statusCode(status), Message: err.Error()}
+	var errCoder errorCoder
+	if errors.As(err, &errCoder) {
+		resp.Code = errCoder.ErrorCode()
+	}
+	var detailer errorDetailer
+	if errors.As(err, &detailer) {
+		resp.Details = detailer.ErrorDetails()
+	}
+	var delayer retryDelayer
+	if errors.As(err, &delayer) && delayer.RetryDelay() > 0 {
+		seconds := int64(math.Ceil(delayer.RetryDelay().Seconds()))
+		w.Header().Set(retryAfterHeader, strconv.FormatInt(seconds, 10))
+	}
+	writeErrorResponse(w, r, status, resp)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, resp ErrorResponse) {
+	resp.RequestID = middleware.GetReqID(r.Context())
+	if resp.RequestID != "" {
+		w.Header().Set(requestIDHeader, resp.RequestID)
+	}
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error writing error response")
+	}
+}
+
+// statusCode returns the code of a status, e.g. "service_unavailable".
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
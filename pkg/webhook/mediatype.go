@@ -5,12 +5,20 @@ import (
 	"strings"
 )
 
-const (
-	mediaTypeFormat        = "application/external.dns.webhook+json;"
-	supportedMediaVersions = "1"
-)
+const mediaTypeFormat = "application/external.dns.webhook+json;"
+
+// supportedMediaTypes lists the media types the webhook can serve, in order of preference.
+// Supporting a new protocol version only requires registering it here.
+var supportedMediaTypes = []mediaType{mediaTypeVersion("1")}
 
-var mediaTypeVersion1 = mediaTypeVersion("1")
+// MediaTypes returns the media types the webhook can serve, in order of preference.
+func MediaTypes() []string {
+	types := make([]string, 0, len(supportedMediaTypes))
+	for _, m := range supportedMediaTypes {
+		types = append(types, string(m))
+	}
+	return types
+}
 
 type mediaType string
 
@@ -19,23 +27,23 @@ func mediaTypeVersion(v string) mediaType {
 }
 
 func (m mediaType) Is(headerValue string) bool {
-	return string(m) == headerValue
+	return string(m) == strings.ReplaceAll(headerValue, " ", "")
 }
 
-func checkAndGetMediaTypeHeaderValue(value string) (string, error) {
-	for _, v := range strings.Split(supportedMediaVersions, ",") {
-		if mediaTypeVersion(v).Is(value) {
-			return v, nil
-		}
-	}
+// Version returns the version parameter of the media type.
+func (m mediaType) Version() string {
+	return strings.TrimPrefix(string(m), mediaTypeFormat+"version=")
+}
 
-	supportedMediaTypesString := ""
-	for i, v := range strings.Split(supportedMediaVersions, ",") {
-		sep := ""
-		if i < len(supportedMediaVersions)-1 {
-			sep = ", "
+// negotiateMediaType returns the supported media type matching the header value.
+// The value may list several comma separated media types, the first supported one wins.
+func negotiateMediaType(value string) (mediaType, error) {
+	for _, candidate := range strings.Split(value, ",") {
+		for _, m := range supportedMediaTypes {
+			if m.Is(candidate) {
+				return m, nil
+			}
 		}
-		supportedMediaTypesString += string(mediaTypeVersion(v)) + sep
 	}
-	return "", fmt.Errorf("unsupported media type version: '%s'. supported media types are: '%s'", value, supportedMediaTypesString)
+	return "", fmt.Errorf("unsupported media type version: '%s'. supported media types are: '%s'", value, strings.Join(MediaTypes(), ", "))
 }
@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{header: "application/external.dns.webhook+json;version=1", want: "application/external.dns.webhook+json;version=1"},
+		{header: "application/external.dns.webhook+json; version=1", want: "application/external.dns.webhook+json;version=1"},
+		{header: "application/external.dns.webhook+json;version=2, application/external.dns.webhook+json;version=1", want: "application/external.dns.webhook+json;version=1"},
+		{header: "application/external.dns.webhook+json;version=2", wantErr: true},
+		{header: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := negotiateMediaType(tt.header)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("negotiateMediaType(%q) error = %v, want error %t", tt.header, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			// The error lists the registered media types.
+			for _, m := range MediaTypes() {
+				if !strings.Contains(err.Error(), m) {
+					t.Errorf("negotiateMediaType(%q) error %q does not list %s", tt.header, err, m)
+				}
+			}
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("negotiateMediaType(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+		if !slices.Contains(MediaTypes(), string(got)) {
+			t.Errorf("negotiated %q is not listed by MediaTypes()", got)
+		}
+	}
+}
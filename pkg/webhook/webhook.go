@@ -1,29 +1,91 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 
-	"github.com/kashalls/external-dns-unifi-webhook/cmd/webhook/init/log"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kashalls/external-dns-unifi-webhook/internal/log"
 
 	"sigs.k8s.io/external-dns/endpoint"
-	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
 
 	"go.uber.org/zap"
 )
 
 const (
-	contentTypeHeader    = "Content-Type"
-	contentTypePlaintext = "text/plain"
-	acceptHeader         = "Accept"
-	varyHeader           = "Vary"
+	contentTypeHeader = "Content-Type"
+	acceptHeader      = "Accept"
+	varyHeader        = "Vary"
+	warningHeader     = "Warning"
 )
 
 // Webhook for external dns provider
 type Webhook struct {
 	provider provider.Provider
+
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+// readinessChecker is implemented by providers that can report whether they are ready to serve requests.
+type readinessChecker interface {
+	Ready() error
+}
+
+// degradationReporter is implemented by providers that can serve requests in a degraded way.
+type degradationReporter interface {
+	Degraded() error
+}
+
+// statusReporter is implemented by providers that can report their runtime state.
+type statusReporter interface {
+	Status() any
+}
+
+// lastApplyReporter is implemented by providers that report the outcome of the most recent plan.
+type lastApplyReporter interface {
+	LastApply() any
+}
+
+// configReporter is implemented by providers that can describe their effective configuration.
+type configReporter interface {
+	EffectiveConfig() any
+}
+
+// staleReporter is implemented by providers that may answer record listings from a snapshot.
+type staleReporter interface {
+	RecordsStale() bool
+}
+
+// healthChecker is implemented by providers that expose checks of their components.
+type healthChecker interface {
+	HealthChecks() map[string]func() error
+}
+
+// stateDumper is implemented by providers that can log a snapshot of their state.
+type stateDumper interface {
+	DumpState()
+}
+
+// rawRecordsReader is implemented by providers that can return the records exactly as the backend sent them.
+type rawRecordsReader interface {
+	RawRecords(ctx context.Context) ([]byte, error)
+}
+
+// duplicatePruner is implemented by providers that can delete duplicate records on demand.
+type duplicatePruner interface {
+	PruneDuplicates(ctx context.Context) (int, error)
+}
+
+// statusCoder is implemented by provider errors that map to a specific HTTP status code.
+type statusCoder interface {
+	HTTPStatusCode() int
 }
 
 // New creates a new instance of the Webhook
@@ -32,15 +94,109 @@ func New(provider provider.Provider) *Webhook {
 	return &p
 }
 
-func (p *Webhook) contentTypeHeaderCheck(w http.ResponseWriter, r *http.Request) error {
+// Ready returns an error when the provider is not ready to serve requests.
+func (p *Webhook) Ready() error {
+	p.mu.Lock()
+	draining := p.draining
+	p.mu.Unlock()
+	if draining {
+		return errors.New("webhook is shutting down")
+	}
+
+	if checker, ok := p.provider.(readinessChecker); ok {
+		return checker.Ready()
+	}
+	return nil
+}
+
+// Readiness states of a webhook.
+const (
+	ReadinessReady    = "ready"
+	ReadinessDegraded = "degraded"
+	ReadinessNotReady = "not-ready"
+)
+
+// Readiness returns the readiness state of the webhook and the reason when it is not ready.
+// A degraded webhook still serves requests, from cached data or while recovering.
+func (p *Webhook) Readiness() (string, error) {
+	if err := p.Ready(); err != nil {
+		return ReadinessNotReady, err
+	}
+	if reporter, ok := p.provider.(degradationReporter); ok {
+		if err := reporter.Degraded(); err != nil {
+			return ReadinessDegraded, err
+		}
+	}
+	return ReadinessReady, nil
+}
+
+// EffectiveConfig returns the effective configuration of the provider with secrets masked, if supported.
+func (p *Webhook) EffectiveConfig() any {
+	if reporter, ok := p.provider.(configReporter); ok {
+		return reporter.EffectiveConfig()
+	}
+	return nil
+}
+
+// HealthChecks returns the component checks of the provider, if any.
+func (p *Webhook) HealthChecks() map[string]func() error {
+	if checker, ok := p.provider.(healthChecker); ok {
+		return checker.HealthChecks()
+	}
+	return nil
+}
+
+// DumpState logs a snapshot of the provider state, if supported.
+func (p *Webhook) DumpState() {
+	if dumper, ok := p.provider.(stateDumper); ok {
+		dumper.DumpState()
+		return
+	}
+	log.Info("provider does not support state dumps")
+}
+
+// Drain stops accepting new changes and waits until in-flight changes have been applied
+// or the context expires.
+func (p *Webhook) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.draining = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginApply registers an in-flight apply, it returns false while draining.
+func (p *Webhook) beginApply() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.draining {
+		return false
+	}
+	p.inflight.Add(1)
+	return true
+}
+
+func (p *Webhook) contentTypeHeaderCheck(w http.ResponseWriter, r *http.Request) (mediaType, error) {
 	return p.headerCheck(true, w, r)
 }
 
-func (p *Webhook) acceptHeaderCheck(w http.ResponseWriter, r *http.Request) error {
+func (p *Webhook) acceptHeaderCheck(w http.ResponseWriter, r *http.Request) (mediaType, error) {
 	return p.headerCheck(false, w, r)
 }
 
-func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http.Request) error {
+// headerCheck negotiates the media type of the request content type or accept header.
+func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http.Request) (mediaType, error) {
 	var header string
 	if isContentType {
 		header = r.Header.Get(contentTypeHeader)
@@ -49,29 +205,20 @@ func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http
 	}
 
 	if len(header) == 0 {
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusNotAcceptable)
-
 		msg := "client must provide "
 		if isContentType {
 			msg += "a content type"
 		} else {
 			msg += "an accept header"
 		}
-		err := fmt.Errorf(msg)
+		err := errors.New(msg)
 
-		_, writeErr := fmt.Fprint(w, err.Error())
-		if writeErr != nil {
-			requestLog(r).With(zap.Error(writeErr)).Fatal("error writing error message to response writer")
-		}
-		return err
+		WriteError(w, r, http.StatusNotAcceptable, err.Error())
+		return "", err
 	}
 
-	// as we support only one media type version, we can ignore the returned value
-	if _, err := checkAndGetMediaTypeHeaderValue(header); err != nil {
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusUnsupportedMediaType)
-
+	negotiated, err := negotiateMediaType(header)
+	if err != nil {
 		msg := "client must provide a valid versioned media type in the "
 		if isContentType {
 			msg += "content type"
@@ -80,19 +227,17 @@ func (p *Webhook) headerCheck(isContentType bool, w http.ResponseWriter, r *http
 		}
 
 		err := fmt.Errorf(msg+": %s", err.Error())
-		_, writeErr := fmt.Fprint(w, err.Error())
-		if writeErr != nil {
-			requestLog(r).With(zap.Error(writeErr)).Fatal("error writing error message to response writer")
-		}
-		return err
+		WriteError(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return "", err
 	}
 
-	return nil
+	return negotiated, nil
 }
 
 // Records handles the get request for records
 func (p *Webhook) Records(w http.ResponseWriter, r *http.Request) {
-	if err := p.acceptHeaderCheck(w, r); err != nil {
+	accept, err := p.acceptHeaderCheck(w, r)
+	if err != nil {
 		requestLog(r).With(zap.Error(err)).Error("accept header check failed")
 		return
 	}
@@ -101,12 +246,15 @@ func (p *Webhook) Records(w http.ResponseWriter, r *http.Request) {
 	records, err := p.provider.Records(ctx)
 	if err != nil {
 		requestLog(r).With(zap.Error(err)).Error("error getting records")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProviderError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
+	w.Header().Set(contentTypeHeader, string(accept))
 	w.Header().Set(varyHeader, contentTypeHeader)
+	if reporter, ok := p.provider.(staleReporter); ok && reporter.RecordsStale() {
+		w.Header().Set(warningHeader, `110 - "Response is Stale"`)
+	}
 	err = json.NewEncoder(w).Encode(records)
 	if err != nil {
 		requestLog(r).With(zap.Error(err)).Error("error encoding records")
@@ -117,22 +265,24 @@ func (p *Webhook) Records(w http.ResponseWriter, r *http.Request) {
 
 // ApplyChanges handles the post request for record changes
 func (p *Webhook) ApplyChanges(w http.ResponseWriter, r *http.Request) {
-	if err := p.contentTypeHeaderCheck(w, r); err != nil {
+	if _, err := p.contentTypeHeaderCheck(w, r); err != nil {
 		requestLog(r).With(zap.Error(err)).Error("content type header check failed")
 		return
 	}
 
-	var changes plan.Changes
-	ctx := r.Context()
-	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusBadRequest)
+	if !p.beginApply() {
+		requestLog(r).Warn("rejecting changes while shutting down")
+		WriteError(w, r, http.StatusServiceUnavailable, "webhook is shutting down")
+		return
+	}
+	defer p.inflight.Done()
 
+	ctx := r.Context()
+	changes, err := decodeChanges(r.Body)
+	if err != nil {
 		errMsg := fmt.Sprintf("error decoding changes: %s", err.Error())
-		if _, writeError := fmt.Fprint(w, errMsg); writeError != nil {
-			requestLog(r).With(zap.Error(writeError)).Fatal("error writing error message to response writer")
-		}
 		requestLog(r).With(zap.Error(err)).Info(errMsg)
+		WriteError(w, r, decodeErrorStatus(err), errMsg)
 		return
 	}
 
@@ -142,10 +292,9 @@ func (p *Webhook) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 		zap.Int("update_new", len(changes.UpdateNew)),
 		zap.Int("delete", len(changes.Delete)),
 	).Debug("requesting apply changes")
-	if err := p.provider.ApplyChanges(ctx, &changes); err != nil {
+	if err := p.provider.ApplyChanges(ctx, changes); err != nil {
 		requestLog(r).Error("error when applying changes", zap.Error(err))
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeProviderError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -153,38 +302,33 @@ func (p *Webhook) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 
 // AdjustEndpoints handles the post request for adjusting endpoints
 func (p *Webhook) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
-	if err := p.contentTypeHeaderCheck(w, r); err != nil {
+	if _, err := p.contentTypeHeaderCheck(w, r); err != nil {
 		log.Error("content-type header check failed", zap.String("req_method", r.Method), zap.String("req_path", r.URL.Path))
 		return
 	}
-	if err := p.acceptHeaderCheck(w, r); err != nil {
+	accept, err := p.acceptHeaderCheck(w, r)
+	if err != nil {
 		log.Error("accept header check failed", zap.String("req_method", r.Method), zap.String("req_path", r.URL.Path))
 		return
 	}
 
 	var pve []*endpoint.Endpoint
 	if err := json.NewDecoder(r.Body).Decode(&pve); err != nil {
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusBadRequest)
-
-		errMessage := fmt.Sprintf("failed to decode request body: %v", err)
 		requestLog(r).With(zap.Error(err)).Info("failed to decode request body")
-		if _, writeError := fmt.Fprint(w, errMessage); writeError != nil {
-			requestLog(r).With(zap.Error(writeError)).Fatal("error writing error message to response writer")
-		}
+		WriteError(w, r, decodeErrorStatus(err), fmt.Sprintf("failed to decode request body: %v", err))
 		return
 	}
 
 	log.Debug("adjust endpoints count", zap.Int("endpoints", len(pve)))
-	pve, err := p.provider.AdjustEndpoints(pve)
+	pve, err = p.provider.AdjustEndpoints(pve)
 	if err != nil {
-		w.Header().Set(contentTypeHeader, contentTypePlaintext)
-		w.WriteHeader(http.StatusInternalServerError)
+		requestLog(r).With(zap.Error(err)).Error("error adjusting endpoints")
+		writeProviderError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	out, _ := json.Marshal(&pve)
 
-	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
+	w.Header().Set(contentTypeHeader, string(accept))
 	w.Header().Set(varyHeader, contentTypeHeader)
 	if _, writeError := fmt.Fprint(w, string(out)); writeError != nil {
 		requestLog(r).With(zap.Error(writeError)).Fatal("error writing response")
@@ -192,26 +336,111 @@ func (p *Webhook) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *Webhook) Negotiate(w http.ResponseWriter, r *http.Request) {
-	if err := p.acceptHeaderCheck(w, r); err != nil {
+	accept, err := p.acceptHeaderCheck(w, r)
+	if err != nil {
 		requestLog(r).With(zap.Error(err)).Error("accept header check failed")
 		return
 	}
 
 	b, err := json.Marshal(p.provider.GetDomainFilter())
 	if err != nil {
-		requestLog(r).Error("failed to marshal domain filter")
-		w.WriteHeader(http.StatusInternalServerError)
+		requestLog(r).With(zap.Error(err)).Error("failed to marshal domain filter")
+		WriteError(w, r, http.StatusInternalServerError, "failed to marshal domain filter")
 		return
 	}
 
-	w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
+	w.Header().Set(contentTypeHeader, string(accept))
 	if _, writeError := w.Write(b); writeError != nil {
 		requestLog(r).With(zap.Error(writeError)).Error("error writing response")
-		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+// Status handles the get request for the provider runtime state
+func (p *Webhook) Status(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := p.provider.(statusReporter)
+	if !ok {
+		WriteError(w, r, http.StatusNotFound, "not supported by the provider")
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(reporter.Status()); err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error encoding status")
+	}
+}
+
+// LastApply handles the get request for the summary of the most recent plan
+func (p *Webhook) LastApply(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := p.provider.(lastApplyReporter)
+	if !ok {
+		WriteError(w, r, http.StatusNotFound, "not supported by the provider")
+		return
+	}
+
+	summary := reporter.LastApply()
+	if summary == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error encoding last apply summary")
+	}
+}
+
+// decodeErrorStatus returns the status code for a request body that could not be decoded.
+func decodeErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
 func requestLog(r *http.Request) *zap.Logger {
-	return log.With(zap.String("req_method", r.Method), zap.String("req_path", r.URL.Path))
+	return log.With(zap.String("req_method", r.Method), zap.String("req_path", r.URL.Path), zap.String("req_id", middleware.GetReqID(r.Context())))
+}
+
+// DebugRecords handles the get request for the raw provider records
+func (p *Webhook) DebugRecords(w http.ResponseWriter, r *http.Request) {
+	reader, ok := p.provider.(rawRecordsReader)
+	if !ok {
+		WriteError(w, r, http.StatusNotFound, "not supported by the provider")
+		return
+	}
+
+	raw, err := reader.RawRecords(r.Context())
+	if err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error getting raw records")
+		writeProviderError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if _, err := w.Write(raw); err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error writing raw records")
+	}
+}
+
+// PruneDuplicates handles the post request for deleting duplicate provider records
+func (p *Webhook) PruneDuplicates(w http.ResponseWriter, r *http.Request) {
+	pruner, ok := p.provider.(duplicatePruner)
+	if !ok {
+		WriteError(w, r, http.StatusNotFound, "not supported by the provider")
+		return
+	}
+
+	removed, err := pruner.PruneDuplicates(r.Context())
+	if err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error pruning duplicate records")
+		writeProviderError(w, r, err, http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if err := json.NewEncoder(w).Encode(map[string]int{"removed": removed}); err != nil {
+		requestLog(r).With(zap.Error(err)).Error("error encoding prune result")
+	}
 }